@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"devlog-report/internal/events"
+	"github.com/google/uuid"
+)
+
+const maxBatchEvents = 500
+
+type batchResponse struct {
+	Results []struct {
+		Index   int    `json:"index"`
+		EventID string `json:"event_id"`
+		Status  string `json:"status"`
+		Error   string `json:"error"`
+	} `json:"results"`
+}
+
+type emitter struct {
+	endpoint  string
+	spoolPath string
+	client    *http.Client
+}
+
+func main() {
+	fs := flag.NewFlagSet("devlog-emit", flag.ContinueOnError)
+	endpoint := fs.String("endpoint", envOr("DEVLOG_ENDPOINT", "http://127.0.0.1:8787/events"), "devlogd /events URL")
+	spoolPath := fs.String("spool", envOr("DEVLOG_SPOOL_PATH", defaultSpoolPath()), "spool file for undelivered events")
+	timeout := fs.Duration("timeout", 2*time.Second, "HTTP timeout")
+	source := fs.String("source", "zsh", "event source")
+	eventID := fs.String("event-id", "", "event id (default: random UUID)")
+	start := fs.String("start", "", "command start time (RFC3339)")
+	end := fs.String("end", "", "command end time (RFC3339, default: -start)")
+	cwd := fs.String("cwd", "", "working directory (default: current directory)")
+	command := fs.String("command", "", "command line")
+	exitCode := fs.Int("exit-code", -1, "exit status (omitted when negative)")
+	durationMS := fs.Int64("duration-ms", -1, "runtime in milliseconds (omitted when negative)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: devlog-emit [flags] -start TS -command CMD")
+		fmt.Fprintln(fs.Output(), "       devlog-emit [flags] flush")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	batchURL, err := batchEndpoint(*endpoint)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	e := &emitter{
+		endpoint:  batchURL,
+		spoolPath: *spoolPath,
+		client:    &http.Client{Timeout: *timeout},
+	}
+
+	if fs.NArg() > 0 {
+		if fs.Arg(0) != "flush" || fs.NArg() > 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if err := e.deliver(nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *eventID == "" {
+		*eventID = uuid.NewString()
+	}
+	if *end == "" {
+		*end = *start
+	}
+	if *cwd == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		*cwd = wd
+	}
+	ev := events.Event{
+		Type:          "terminal_command",
+		Source:        *source,
+		EventID:       *eventID,
+		SchemaVersion: events.LatestSchemaVersion,
+		StartTS:       *start,
+		EndTS:         *end,
+		CWD:           *cwd,
+		Command:       *command,
+	}
+	if *exitCode >= 0 {
+		ev.ExitCode = exitCode
+	}
+	if *durationMS >= 0 {
+		ev.DurationMS = durationMS
+	}
+
+	line, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := events.Normalize(line); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid event: %v\n", err)
+		os.Exit(2)
+	}
+	if err := e.deliver(line); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func (e *emitter) deliver(line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(e.spoolPath), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(e.spoolPath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	pending, err := readSpool(f)
+	if err != nil {
+		return err
+	}
+	if line != nil {
+		pending = append(pending, line)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	sent := 0
+	var postErr error
+	for sent < len(pending) {
+		n := min(len(pending)-sent, maxBatchEvents)
+		if postErr = e.post(pending[sent : sent+n]); postErr != nil {
+			break
+		}
+		sent += n
+	}
+	if err := rewriteSpool(f, pending[sent:]); err != nil {
+		return err
+	}
+	if postErr != nil && line == nil {
+		return fmt.Errorf("flush failed, %d events kept in %s: %w", len(pending)-sent, e.spoolPath, postErr)
+	}
+	return nil
+}
+
+func (e *emitter) post(lines [][]byte) error {
+	body := bytes.Join(lines, []byte("\n"))
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", e.endpoint, resp.Status)
+	}
+
+	var out batchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	for _, result := range out.Results {
+		if result.Status == "invalid" || result.Status == "conflict" {
+			fmt.Fprintf(os.Stderr, "dropped event %s: %s: %s\n", result.EventID, result.Status, result.Error)
+		}
+	}
+	return nil
+}
+
+func readSpool(f *os.File) ([][]byte, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		lines = append(lines, append([]byte(nil), line...))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", f.Name(), err)
+	}
+	return lines, nil
+}
+
+func rewriteSpool(f *os.File, lines [][]byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func defaultSpoolPath() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "devlog", "spool.ndjson")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "devlog-spool.ndjson"
+	}
+	return filepath.Join(home, ".local", "state", "devlog", "spool.ndjson")
+}
+
+func batchEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid -endpoint: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid -endpoint %q: want http(s)://host[:port]/events", endpoint)
+	}
+	u.Path = "/events:batch"
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	maxBatchBodyBytes = 16 << 20
+
+	batchStatusOK        = "ok"
+	batchStatusDuplicate = "duplicate"
+	batchStatusInvalid   = "invalid"
+	batchStatusConflict  = "conflict"
+	batchStatusIgnored   = "ignored"
+)
+
+type batchResult struct {
+	Index     int             `json:"index"`
+	EventID   string          `json:"event_id,omitempty"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	Conflicts []fieldConflict `json:"conflicts,omitempty"`
+}
+
+func splitBatchBody(body []byte) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, errors.New("body is empty")
+	}
+	if trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, errors.New("body must be a JSON array or NDJSON")
+		}
+		out := make([][]byte, len(items))
+		for i, item := range items {
+			out[i] = item
+		}
+		return out, nil
+	}
+
+	var out [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64<<10), maxBatchBodyBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		out = append(out, append([]byte(nil), line...))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type batchItem struct {
+	payload    []byte
+	receivedAt time.Time
+}
+
+func batchItems(payloads [][]byte) []batchItem {
+	now := time.Now()
+	out := make([]batchItem, len(payloads))
+	for i, payload := range payloads {
+		out[i] = batchItem{payload: payload, receivedAt: now}
+	}
+	return out
+}
+
+func (s *eventStore) insertBatch(items []batchItem, privacy *privacyPolicy) ([]batchResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]batchResult, len(items))
+	for i, item := range items {
+		results[i].Index = i
+		ev, payload, err := privacy.prepare(item.payload)
+		if errors.Is(err, errIgnoredEvent) {
+			results[i].EventID = ev.EventID
+			results[i].Status = batchStatusIgnored
+			continue
+		}
+		if err != nil {
+			results[i].Status = batchStatusInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].EventID = ev.EventID
+		if err := insertEvent(tx, ev, string(payload), item.receivedAt); err != nil {
+			if errors.Is(err, errDuplicateEvent) {
+				conflicts, err := duplicateConflicts(tx, ev)
+				if err != nil {
+					_ = tx.Rollback()
+					return nil, err
+				}
+				results[i].Status = batchStatusDuplicate
+				if len(conflicts) > 0 {
+					results[i].Status = batchStatusConflict
+					results[i].Error = "event_id already exists with a different payload"
+					results[i].Conflicts = conflicts
+				}
+				continue
+			}
+			_ = tx.Rollback()
+			return nil, err
+		}
+		results[i].Status = batchStatusOK
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func countBatchResults(results []batchResult) map[string]int {
+	counts := map[string]int{
+		batchStatusOK:        0,
+		batchStatusDuplicate: 0,
+		batchStatusInvalid:   0,
+		batchStatusConflict:  0,
+		batchStatusIgnored:   0,
+	}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	return counts
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"devlog-report/internal/events"
+	"github.com/google/uuid"
+)
+
+const chromeEpochOffsetMicros = 11644473600 * 1000000
+
+var chromeEpoch = time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type chromeVisit struct {
+	id       int64
+	url      string
+	title    string
+	start    time.Time
+	duration time.Duration
+}
+
+func chromeTime(micros int64) time.Time {
+	return time.UnixMicro(micros - chromeEpochOffsetMicros).UTC()
+}
+
+func chromeMicros(t time.Time) int64 {
+	return t.UnixMicro() + chromeEpochOffsetMicros
+}
+
+func readChromeVisits(path string, from, to time.Time) ([]chromeVisit, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+SELECT visits.id, urls.url, urls.title, visits.visit_time, visits.visit_duration
+FROM visits
+JOIN urls ON urls.id = visits.url
+WHERE visits.visit_time >= ? AND visits.visit_time < ? AND visits.visit_duration > 0
+ORDER BY visits.visit_time
+`, chromeMicros(from), chromeMicros(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []chromeVisit
+	for rows.Next() {
+		var visit chromeVisit
+		var title sql.NullString
+		var visitTime int64
+		var duration int64
+		if err := rows.Scan(&visit.id, &visit.url, &title, &visitTime, &duration); err != nil {
+			return nil, err
+		}
+		visit.title = strings.TrimSpace(title.String)
+		if visit.title == "" {
+			visit.title = visit.url
+		}
+		visit.start = chromeTime(visitTime)
+		visit.duration = time.Duration(duration) * time.Microsecond
+		out = append(out, visit)
+	}
+	return out, rows.Err()
+}
+
+func (s *eventStore) browserCoverage(from, to time.Time) ([]interval, error) {
+	rows, err := s.db.Query(`
+SELECT start_ms, end_ms
+FROM events
+WHERE type = 'browser_active_span' AND source != ? AND end_ms > ? AND start_ms < ?
+ORDER BY start_ms
+`, importSource, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []interval
+	for rows.Next() {
+		var startMS int64
+		var endMS int64
+		if err := rows.Scan(&startMS, &endMS); err != nil {
+			return nil, err
+		}
+		next := interval{start: time.UnixMilli(startMS), end: time.UnixMilli(endMS)}
+		if n := len(out); n > 0 && !next.start.After(out[n-1].end) {
+			if next.end.After(out[n-1].end) {
+				out[n-1].end = next.end
+			}
+			continue
+		}
+		out = append(out, next)
+	}
+	return out, rows.Err()
+}
+
+func overlapsAny(covered []interval, value interval) bool {
+	i := sort.Search(len(covered), func(i int) bool {
+		return covered[i].end.After(value.start)
+	})
+	return i < len(covered) && covered[i].start.Before(value.end)
+}
+
+func chromeEvents(visits []chromeVisit, covered []interval) ([][]byte, int) {
+	out := make([][]byte, 0, len(visits))
+	skipped := 0
+	for _, visit := range visits {
+		end := visit.start.Add(visit.duration)
+		if overlapsAny(covered, interval{start: visit.start, end: end}) {
+			skipped++
+			continue
+		}
+		id := uuid.NewSHA1(importNamespace, []byte(fmt.Sprintf("chrome-history\x00%d\x00%d", visit.id, chromeMicros(visit.start))))
+		ev := events.Event{
+			Type:          "browser_active_span",
+			Source:        importSource,
+			EventID:       id.String(),
+			SchemaVersion: events.LatestSchemaVersion,
+			StartTS:       visit.start.UTC().Format(time.RFC3339Nano),
+			EndTS:         end.UTC().Format(time.RFC3339Nano),
+			URL:           visit.url,
+			Title:         visit.title,
+		}
+		data, _ := json.Marshal(ev)
+		out = append(out, data)
+	}
+	return out, skipped
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+func runCommand(name string, args []string) int {
+	switch name {
+	case "validate":
+		return runValidate(args)
+	case "explain":
+		return runExplain(args)
+	case "migrate":
+		return runMigrate(args)
+	case "import":
+		return runImport(args)
+	case "restore":
+		return runRestore(args)
+	case "redact":
+		return runRedact(args)
+	case "purge":
+		return runPurge(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", name)
+		fmt.Fprintln(os.Stderr, "usage: devlogd [validate [projects.yaml] | explain [flags] | migrate status|up|down-to N | import zsh-history|bash-history|chrome-history FILE | restore FILE | redact [-rewrite] | purge -from X -to Y [-dry-run]]")
+		return 2
+	}
+}
+
+func runValidate(args []string) int {
+	path := envOr("DEVLOG_PROJECTS_PATH", "./projects.yaml")
+	if len(args) > 0 {
+		path = args[0]
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", path, err)
+		return 1
+	}
+	_, problems := validateProjectsConfig(data)
+	if len(problems) == 0 {
+		fmt.Printf("%s: ok\n", path)
+		return 0
+	}
+	for _, problem := range problems {
+		fmt.Printf("%s: %s\n", path, problem)
+	}
+	return 1
+}
+
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	path := fs.String("config", envOr("DEVLOG_PROJECTS_PATH", "./projects.yaml"), "projects.yaml path")
+	title := fs.String("title", "", "browser title")
+	url := fs.String("url", "", "browser url")
+	cwd := fs.String("cwd", "", "terminal cwd")
+	command := fs.String("command", "", "terminal command")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *title == "" && *url == "" && *cwd == "" && *command == "" {
+		fmt.Fprintln(os.Stderr, "one of -title, -url, -cwd or -command is required")
+		return 2
+	}
+
+	cfg, err := loadProjectsConfig(*path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	compiled, err := compileProjectMatchers(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	snap := &projectsSnapshot{cfg: cfg, compiled: compiled}
+
+	if *title != "" || *url != "" {
+		printExplanation("browser", explainBrowser(snap, browserKey{title: *title, url: *url}))
+	}
+	if *cwd != "" || *command != "" {
+		printExplanation("terminal", explainTerminal(snap, terminalKey{cwd: *cwd, command: *command}))
+	}
+	return 0
+}
+
+func printExplanation(source string, ex ruleExplanation) {
+	if ex.Matched == nil {
+		fmt.Printf("%s: %s (no rule matched)\n", source, ex.Project)
+	} else {
+		fmt.Printf("%s: %s (%s[%d] %q)\n", source, ex.Project, ex.Matched.Field, ex.Matched.Index, ex.Matched.Pattern)
+	}
+	for _, m := range ex.Shadowed {
+		fmt.Printf("  shadowed: %s (%s[%d] %q)\n", m.Project, m.Field, m.Index, m.Pattern)
+	}
+}
+
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dbPath := fs.String("db", envOr("DEVLOG_DB_PATH", "./data/devlog.db"), "sqlite database path")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: devlogd migrate [-db path] status|up|down-to N")
+		return 2
+	}
+
+	store, err := newEventStore(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open event store: %v\n", err)
+		return 1
+	}
+	defer store.close()
+
+	switch fs.Arg(0) {
+	case "status":
+		statuses, err := migrationStatuses(store.db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, status := range statuses {
+			if status.Applied {
+				fmt.Printf("%3d %-32s applied %s\n", status.Version, status.Name, status.AppliedAt)
+			} else {
+				fmt.Printf("%3d %-32s pending\n", status.Version, status.Name)
+			}
+		}
+		return 0
+	case "up":
+		done, err := migrateUp(store.db)
+		for _, m := range done {
+			fmt.Printf("applied %d %s\n", m.version, m.name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("already up to date")
+		}
+		return 0
+	case "down-to":
+		if fs.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "usage: devlogd migrate down-to N")
+			return 2
+		}
+		target, err := strconv.Atoi(fs.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid version: %s\n", fs.Arg(1))
+			return 2
+		}
+		done, err := migrateDownTo(store.db, target)
+		for _, m := range done {
+			fmt.Printf("reverted %d %s\n", m.version, m.name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("nothing to revert")
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command: %s\n", fs.Arg(0))
+		return 2
+	}
+}
+
+func runImport(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: devlogd import zsh-history|bash-history|chrome-history [flags] FILE")
+		return 2
+	}
+	kind := args[0]
+
+	home, _ := os.UserHomeDir()
+	fs := flag.NewFlagSet("import "+kind, flag.ContinueOnError)
+	dbPath := fs.String("db", envOr("DEVLOG_DB_PATH", "./data/devlog.db"), "sqlite database path")
+	configPath := fs.String("config", envOr("DEVLOG_PROJECTS_PATH", "./projects.yaml"), "projects.yaml path (privacy rules)")
+	dryRun := fs.Bool("dry-run", false, "parse and report without writing")
+	var cwd, from, to *string
+	var trackCD *bool
+	switch kind {
+	case "zsh-history", "bash-history":
+		cwd = fs.String("cwd", home, "cwd recorded for imported commands")
+		trackCD = fs.Bool("track-cd", false, "follow plain `cd DIR` commands to guess the cwd of later commands")
+	case "chrome-history":
+		from = fs.String("from", "", "first day to import (YYYY-MM-DD)")
+		to = fs.String("to", "", "last day to import (YYYY-MM-DD)")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown import source: %s\n", kind)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: devlogd import %s [flags] FILE\n", kind)
+		return 2
+	}
+	path := fs.Arg(0)
+
+	store, err := newEventStore(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open event store: %v\n", err)
+		return 1
+	}
+	defer store.close()
+	if _, err := migrateUp(store.db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate events: %v\n", err)
+		return 1
+	}
+
+	var items [][]byte
+	var skipped string
+	switch kind {
+	case "chrome-history":
+		start, end, err := importRange(*from, *to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		visits, err := readChromeVisits(path, start, end)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", path, err)
+			return 1
+		}
+		covered, err := store.browserCoverage(start, end)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load browser spans: %v\n", err)
+			return 1
+		}
+		var n int
+		items, n = chromeEvents(visits, covered)
+		skipped = fmt.Sprintf("%d visits already covered by browser spans", n)
+	default:
+		if *cwd == "" {
+			fmt.Fprintln(os.Stderr, "-cwd is required")
+			return 2
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		entries, n, err := parseShellHistory(f)
+		_ = f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", path, err)
+			return 1
+		}
+		items = historyEvents(entries, &cwdTracker{home: home, current: *cwd, enabled: *trackCD})
+		skipped = fmt.Sprintf("%d lines without a timestamp", n)
+	}
+
+	if *dryRun {
+		fmt.Printf("parsed %d events, skipped %s\n", len(items), skipped)
+		return 0
+	}
+	privacy, err := loadPrivacyPolicy(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	results, err := store.insertBatch(batchItems(items), privacy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to persist events: %v\n", err)
+		return 1
+	}
+	for _, result := range results {
+		if result.Status == batchStatusInvalid || result.Status == batchStatusConflict {
+			fmt.Fprintf(os.Stderr, "event %d: %s: %s\n", result.Index, result.Status, result.Error)
+		}
+	}
+	counts := countBatchResults(results)
+	fmt.Printf("imported %d events (%d duplicate, %d conflict, %d invalid, %d ignored), skipped %s\n",
+		counts[batchStatusOK], counts[batchStatusDuplicate], counts[batchStatusConflict], counts[batchStatusInvalid], counts[batchStatusIgnored], skipped)
+	return 0
+}
+
+func importRange(from, to string) (time.Time, time.Time, error) {
+	opts, err := loadDayOptions(envOr("DEVLOG_TZ", ""), envOr("DEVLOG_DAY_START", "00:00"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start := chromeEpoch
+	end := time.Now().Add(24 * time.Hour)
+	if from != "" {
+		if _, err := time.Parse(dateLayout, from); err != nil {
+			return time.Time{}, time.Time{}, errors.New("-from must be YYYY-MM-DD")
+		}
+		start = opts.window(from).start
+	}
+	if to != "" {
+		if _, err := time.Parse(dateLayout, to); err != nil {
+			return time.Time{}, time.Time{}, errors.New("-to must be YYYY-MM-DD")
+		}
+		end = opts.window(to).end
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("-from must not be after -to")
+	}
+	return start, end, nil
+}
+
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dbPath := fs.String("db", envOr("DEVLOG_DB_PATH", "./data/devlog.db"), "sqlite database path")
+	configPath := fs.String("config", envOr("DEVLOG_PROJECTS_PATH", "./projects.yaml"), "projects.yaml path (privacy rules)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: devlogd restore [-db path] [-config projects.yaml] FILE|-")
+		return 2
+	}
+
+	privacy, err := loadPrivacyPolicy(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	in := os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	store, err := newEventStore(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open event store: %v\n", err)
+		return 1
+	}
+	defer store.close()
+	if _, err := migrateUp(store.db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate events: %v\n", err)
+		return 1
+	}
+
+	counts, err := store.restore(in, privacy, func(line int, result batchResult) {
+		if result.Status == batchStatusInvalid || result.Status == batchStatusConflict {
+			fmt.Fprintf(os.Stderr, "line %d: %s: %s\n", line, result.Status, result.Error)
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("restored %d events (%d duplicate, %d conflict, %d invalid, %d ignored)\n",
+		counts[batchStatusOK], counts[batchStatusDuplicate], counts[batchStatusConflict], counts[batchStatusInvalid], counts[batchStatusIgnored])
+	return 0
+}
+
+func runRedact(args []string) int {
+	fs := flag.NewFlagSet("redact", flag.ContinueOnError)
+	dbPath := fs.String("db", envOr("DEVLOG_DB_PATH", "./data/devlog.db"), "sqlite database path")
+	configPath := fs.String("config", envOr("DEVLOG_PROJECTS_PATH", "./projects.yaml"), "projects.yaml path (privacy rules)")
+	rewrite := fs.Bool("rewrite", false, "update matching rows instead of only counting them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: devlogd redact [-db path] [-config projects.yaml] [-rewrite]")
+		return 2
+	}
+
+	privacy, err := loadPrivacyPolicy(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	store, err := newEventStore(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open event store: %v\n", err)
+		return 1
+	}
+	defer store.close()
+	if _, err := migrateUp(store.db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate events: %v\n", err)
+		return 1
+	}
+
+	redacted, rollups, err := store.redactStored(privacy, *rewrite)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "redact failed: %v\n", err)
+		return 1
+	}
+	if !*rewrite {
+		fmt.Printf("%d events and %d rollups would be redacted; run with -rewrite to apply\n", redacted, rollups)
+		return 0
+	}
+	fmt.Printf("redacted %d events and %d rollups\n", redacted, rollups)
+	return 0
+}
+
+func runPurge(args []string) int {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	dbPath := fs.String("db", envOr("DEVLOG_DB_PATH", "./data/devlog.db"), "sqlite database path")
+	from := fs.String("from", "", "first day (YYYY-MM-DD) or instant (RFC3339) to purge")
+	to := fs.String("to", "", "last day (YYYY-MM-DD) or end instant (RFC3339, exclusive)")
+	eventType := fs.String("type", "", "browser_active_span or terminal_command (default: both)")
+	match := fs.String("match", "", "only events whose url, title, cwd or command matches this regexp")
+	dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: devlogd purge [-db path] -from X -to Y [-type T] [-match RE] [-dry-run]")
+		return 2
+	}
+
+	opts, err := loadDayOptions(envOr("DEVLOG_TZ", ""), envOr("DEVLOG_DAY_START", "00:00"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid DEVLOG_TZ/DEVLOG_DAY_START: %v\n", err)
+		return 2
+	}
+	filter, err := parsePurgeFilter(url.Values{
+		"from":  {*from},
+		"to":    {*to},
+		"type":  {*eventType},
+		"match": {*match},
+	}, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	store, err := newEventStore(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open event store: %v\n", err)
+		return 1
+	}
+	defer store.close()
+	if _, err := migrateUp(store.db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate events: %v\n", err)
+		return 1
+	}
+
+	result, err := store.purge(filter, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "purge failed: %v\n", err)
+		return 1
+	}
+	for _, ev := range result.Preview {
+		if ev.Type == "browser_active_span" {
+			fmt.Printf("%s  %s  %s  %s\n", ev.StartTS, ev.EventID, ev.Title, ev.URL)
+		} else {
+			fmt.Printf("%s  %s  %s  %s\n", ev.StartTS, ev.EventID, ev.CWD, ev.Command)
+		}
+	}
+	if len(result.Preview) < result.Events {
+		fmt.Printf("... and %d more\n", result.Events-len(result.Preview))
+	}
+	if *dryRun {
+		fmt.Printf("would delete %d events and trim %d rollups\n", result.Events, result.Rollups)
+		return 0
+	}
+	if result.PurgeID == 0 {
+		fmt.Println("nothing to purge")
+		return 0
+	}
+	fmt.Printf("deleted %d events and trimmed %d rollups (purge %d)\n", result.Events, result.Rollups, result.PurgeID)
+	return 0
+}
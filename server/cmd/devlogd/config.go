@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type projectsSnapshot struct {
+	cfg      ProjectsConfig
+	compiled []compiledProject
+	privacy  *privacyPolicy
+	version  int64
+	loadedAt time.Time
+	modTime  time.Time
+}
+
+type projectsManager struct {
+	path    string
+	current atomic.Pointer[projectsSnapshot]
+
+	mu        sync.Mutex
+	version   int64
+	seenMod   time.Time
+	seenSize  int64
+	seenFile  bool
+	lastErr   error
+	lastErrAt time.Time
+}
+
+func newProjectsManager(path string) *projectsManager {
+	m := &projectsManager{path: path}
+	m.reload(true)
+	return m
+}
+
+func (m *projectsManager) snapshot() *projectsSnapshot {
+	return m.current.Load()
+}
+
+func (m *projectsManager) reload(force bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := os.Stat(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		if force || m.current.Load() == nil {
+			m.seenFile = false
+			m.swap(ProjectsConfig{}, nil, defaultPrivacyPolicy, time.Time{})
+			return
+		}
+		if m.seenFile && !errors.Is(m.lastErr, os.ErrNotExist) {
+			m.fail(err)
+		}
+		return
+	}
+	if err != nil {
+		m.fail(err)
+		return
+	}
+	if !force && m.seenFile && info.ModTime().Equal(m.seenMod) && info.Size() == m.seenSize {
+		if errors.Is(m.lastErr, os.ErrNotExist) {
+			m.lastErr = nil
+			m.lastErrAt = time.Time{}
+		}
+		return
+	}
+	m.seenFile = true
+	m.seenMod = info.ModTime()
+	m.seenSize = info.Size()
+
+	cfg, err := loadProjectsConfig(m.path)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+	compiled, err := compileProjectMatchers(cfg)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+	privacy, err := compilePrivacyPolicy(cfg.Privacy)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+	m.swap(cfg, compiled, privacy, info.ModTime())
+}
+
+func (m *projectsManager) swap(cfg ProjectsConfig, compiled []compiledProject, privacy *privacyPolicy, modTime time.Time) {
+	m.version++
+	m.lastErr = nil
+	m.lastErrAt = time.Time{}
+	m.current.Store(&projectsSnapshot{
+		cfg:      cfg,
+		compiled: compiled,
+		privacy:  privacy,
+		version:  m.version,
+		loadedAt: time.Now().UTC(),
+		modTime:  modTime,
+	})
+	log.Printf("projects config loaded: %s (version %d)", m.path, m.version)
+}
+
+func (m *projectsManager) fail(err error) {
+	m.lastErr = err
+	m.lastErrAt = time.Now().UTC()
+	if m.current.Load() == nil {
+		log.Printf("projects config not loaded: %v", err)
+		return
+	}
+	log.Printf("projects config reload failed, keeping version %d: %v", m.version, err)
+}
+
+func (m *projectsManager) privacy() (*privacyPolicy, bool) {
+	snap := m.snapshot()
+	if snap == nil {
+		return nil, false
+	}
+	return snap.privacy, true
+}
+
+func (m *projectsManager) loadError() (error, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastErr, m.lastErrAt
+}
+
+func (m *projectsManager) watch(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			m.reload(false)
+		}
+	}()
+}
+
+func (m *projectsManager) status() map[string]any {
+	out := map[string]any{
+		"path":    m.path,
+		"version": int64(0),
+	}
+	if snap := m.snapshot(); snap != nil {
+		out["version"] = snap.version
+		out["loaded_at"] = snap.loadedAt.Format(time.RFC3339Nano)
+		out["projects"] = len(snap.cfg.Projects)
+		if !snap.modTime.IsZero() {
+			out["mod_time"] = snap.modTime.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	if err, at := m.loadError(); err != nil {
+		out["error"] = err.Error()
+		out["error_at"] = at.Format(time.RFC3339Nano)
+		var cfgErr *configError
+		if errors.As(err, &cfgErr) {
+			out["error"] = "invalid projects config"
+			out["problems"] = cfgErr.problems
+		}
+	}
+	return out
+}
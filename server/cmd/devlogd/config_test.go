@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadKeepsConfigWhenFileDisappears(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "projects.yaml")
+	config := "projects:\n  - name: x\n    match:\n      terminal:\n        cwd: [\"^/x\"]\nprivacy:\n  deny:\n    cwd: [\"^/secret\"]\n"
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := newProjectsManager(path)
+	loaded := m.snapshot()
+	if loaded == nil || len(loaded.cfg.Projects) != 1 {
+		t.Fatalf("initial load: got %+v", loaded)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	m.reload(false)
+	if m.snapshot() != loaded {
+		t.Fatal("a missing file replaced the loaded config")
+	}
+	privacy, ok := m.privacy()
+	if !ok || len(privacy.denyCWD) != 1 {
+		t.Fatal("deny rules were dropped with the file")
+	}
+	if err, _ := m.loadError(); !os.IsNotExist(err) {
+		t.Fatalf("load error: got %v, want not exist", err)
+	}
+
+	if err := os.WriteFile(path, []byte(config+"output:\n  other_name: Rest\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m.reload(false)
+	if got := m.snapshot().cfg.Output.otherName(); got != "Rest" {
+		t.Fatalf("reload after the file came back: other name %q", got)
+	}
+	if err, _ := m.loadError(); err != nil {
+		t.Fatalf("load error after reload: %v", err)
+	}
+}
+
+func TestMissingFileAtStartupUsesDefaults(t *testing.T) {
+	m := newProjectsManager(filepath.Join(t.TempDir(), "projects.yaml"))
+	if _, ok := m.privacy(); !ok {
+		t.Fatal("a missing file at startup must load the default config")
+	}
+	if snap := m.snapshot(); len(snap.cfg.Projects) != 0 {
+		t.Fatalf("projects: got %d, want 0", len(snap.cfg.Projects))
+	}
+}
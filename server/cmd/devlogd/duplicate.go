@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"devlog-report/internal/events"
+)
+
+type fieldConflict struct {
+	Field    string `json:"field"`
+	Existing any    `json:"existing"`
+	Incoming any    `json:"incoming"`
+}
+
+func duplicateConflicts(db dbHandle, ev events.Event) ([]fieldConflict, error) {
+	var payload string
+	err := db.QueryRow(`SELECT payload FROM events WHERE event_id = ?`, ev.EventID).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing, err := events.Normalize([]byte(payload))
+	if err != nil {
+		return []fieldConflict{{Field: "payload", Existing: payload}}, nil
+	}
+	return diffEvents(existing, ev), nil
+}
+
+func diffEvents(existing, incoming events.Event) []fieldConflict {
+	a := eventFields(existing)
+	b := eventFields(incoming)
+	names := make(map[string]bool, len(a)+len(b))
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+
+	var out []fieldConflict
+	for name := range names {
+		if a[name] != b[name] {
+			out = append(out, fieldConflict{Field: name, Existing: a[name], Incoming: b[name]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Field < out[j].Field
+	})
+	return out
+}
+
+func eventFields(ev events.Event) map[string]any {
+	data, _ := json.Marshal(ev)
+	var out map[string]any
+	_ = json.Unmarshal(data, &out)
+	return out
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"regexp"
+)
+
+type ruleMatch struct {
+	Project      string `json:"project"`
+	ProjectIndex int    `json:"project_index"`
+	Field        string `json:"field"`
+	Index        int    `json:"index"`
+	Pattern      string `json:"pattern"`
+}
+
+type ruleExplanation struct {
+	Project  string      `json:"project"`
+	Matched  *ruleMatch  `json:"matched"`
+	Shadowed []ruleMatch `json:"shadowed"`
+}
+
+type ruleField struct {
+	name     string
+	patterns []*regexp.Regexp
+	value    string
+}
+
+func explainRules(compiled []compiledProject, otherName string, fields func(project compiledProject) []ruleField) ruleExplanation {
+	out := ruleExplanation{Project: otherName, Shadowed: []ruleMatch{}}
+	for i, project := range compiled {
+		for _, field := range fields(project) {
+			for j, re := range field.patterns {
+				if !re.MatchString(field.value) {
+					continue
+				}
+				match := ruleMatch{
+					Project:      project.name,
+					ProjectIndex: i,
+					Field:        field.name,
+					Index:        j,
+					Pattern:      re.String(),
+				}
+				switch {
+				case out.Matched == nil:
+					out.Project = project.name
+					out.Matched = &match
+				case out.Matched.ProjectIndex != i:
+					out.Shadowed = append(out.Shadowed, match)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func explainBrowser(projects *projectsSnapshot, key browserKey) ruleExplanation {
+	return explainRules(projects.compiled, projects.cfg.Output.otherName(), func(project compiledProject) []ruleField {
+		return []ruleField{
+			{name: "browser.title", patterns: project.browserTitleRe, value: key.title},
+			{name: "browser.url", patterns: project.browserURLRe, value: key.url},
+		}
+	})
+}
+
+func explainTerminal(projects *projectsSnapshot, key terminalKey) ruleExplanation {
+	return explainRules(projects.compiled, projects.cfg.Output.otherName(), func(project compiledProject) []ruleField {
+		return []ruleField{
+			{name: "terminal.cwd", patterns: project.terminalCwdRe, value: key.cwd},
+			{name: "terminal.command", patterns: project.terminalCmdRe, value: key.command},
+		}
+	})
+}
+
+func explainInput(projects *projectsSnapshot, title, url, cwd, command string) map[string]any {
+	out := map[string]any{}
+	if title != "" || url != "" {
+		out["browser"] = explainBrowser(projects, browserKey{title: title, url: url})
+	}
+	if cwd != "" || command != "" {
+		out["terminal"] = explainTerminal(projects, terminalKey{cwd: cwd, command: command})
+	}
+	return out
+}
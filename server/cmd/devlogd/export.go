@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const restoreChunkSize = 1000
+
+type exportLine struct {
+	ReceivedAt string          `json:"received_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type exportFilter struct {
+	startMS   *int64
+	endMS     *int64
+	eventType string
+}
+
+func parseExportFilter(query url.Values, defaults dayOptions) (exportFilter, error) {
+	var filter exportFilter
+	opts, err := parseDayOptions(query, defaults)
+	if err != nil {
+		return exportFilter{}, err
+	}
+	if from := query.Get("from"); from != "" {
+		if _, err := time.Parse(dateLayout, from); err != nil {
+			return exportFilter{}, errors.New("from must be YYYY-MM-DD")
+		}
+		startMS := opts.window(from).start.UnixMilli()
+		filter.startMS = &startMS
+	}
+	if to := query.Get("to"); to != "" {
+		if _, err := time.Parse(dateLayout, to); err != nil {
+			return exportFilter{}, errors.New("to must be YYYY-MM-DD")
+		}
+		endMS := opts.window(to).end.UnixMilli()
+		filter.endMS = &endMS
+	}
+	if filter.startMS != nil && filter.endMS != nil && *filter.endMS <= *filter.startMS {
+		return exportFilter{}, errors.New("to must not be before from")
+	}
+	switch eventType := query.Get("type"); eventType {
+	case "", "browser_active_span", "terminal_command":
+		filter.eventType = eventType
+	default:
+		return exportFilter{}, errors.New("type must be 'browser_active_span' or 'terminal_command'")
+	}
+	return filter, nil
+}
+
+func (f exportFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	if f.eventType != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, f.eventType)
+	}
+	if f.startMS != nil {
+		conditions = append(conditions, "start_ms >= ?")
+		args = append(args, *f.startMS)
+	}
+	if f.endMS != nil {
+		conditions = append(conditions, "start_ms < ?")
+		args = append(args, *f.endMS)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *eventStore) exportEvents(w io.Writer, filter exportFilter) (int, error) {
+	where, args := filter.where()
+	rows, err := s.db.Query(`SELECT payload, received_at FROM events `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	n := 0
+	for rows.Next() {
+		var payload string
+		var receivedAt string
+		if err := rows.Scan(&payload, &receivedAt); err != nil {
+			return n, err
+		}
+		if err := enc.Encode(exportLine{ReceivedAt: receivedAt, Payload: json.RawMessage(payload)}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+func parseRestoreLine(line []byte) (batchItem, error) {
+	var envelope struct {
+		ReceivedAt string          `json:"received_at"`
+		Payload    json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(line, &envelope); err != nil {
+		return batchItem{}, err
+	}
+	if len(envelope.Payload) == 0 {
+		return batchItem{payload: line, receivedAt: time.Now()}, nil
+	}
+	item := batchItem{payload: envelope.Payload, receivedAt: time.Now()}
+	if envelope.ReceivedAt != "" {
+		receivedAt, err := time.Parse(time.RFC3339Nano, envelope.ReceivedAt)
+		if err != nil {
+			return batchItem{}, errors.New("received_at must be RFC3339")
+		}
+		item.receivedAt = receivedAt
+	}
+	return item, nil
+}
+
+func (s *eventStore) restore(r io.Reader, privacy *privacyPolicy, report func(line int, result batchResult)) (map[string]int, error) {
+	counts := countBatchResults(nil)
+	var items []batchItem
+	var lines []int
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		results, err := s.insertBatch(items, privacy)
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			counts[result.Status]++
+			report(lines[i], result)
+		}
+		items = items[:0]
+		lines = lines[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxBatchBodyBytes)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		item, err := parseRestoreLine(append([]byte(nil), line...))
+		if err != nil {
+			counts[batchStatusInvalid]++
+			report(lineNo, batchResult{Status: batchStatusInvalid, Error: err.Error()})
+			continue
+		}
+		items = append(items, item)
+		lines = append(lines, lineNo)
+		if len(items) == restoreChunkSize {
+			if err := flush(); err != nil {
+				return counts, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return counts, fmt.Errorf("line %d: %w", lineNo+1, err)
+	}
+	return counts, flush()
+}
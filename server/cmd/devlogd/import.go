@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"devlog-report/internal/events"
+	"github.com/google/uuid"
+)
+
+const importSource = "import"
+
+var importNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("devlog-report:import"))
+
+type historyEntry struct {
+	start       time.Time
+	duration    time.Duration
+	hasDuration bool
+	command     string
+}
+
+func parseShellHistory(r io.Reader) ([]historyEntry, int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+
+	var out []historyEntry
+	skipped := 0
+	var current *historyEntry
+	continued := false
+	flush := func() {
+		if current != nil && strings.TrimSpace(current.command) != "" {
+			out = append(out, *current)
+		}
+		current = nil
+	}
+
+	for scanner.Scan() {
+		line := unmetafy(scanner.Bytes())
+		if continued && current != nil {
+			current.command += "\n" + strings.TrimSuffix(line, `\`)
+			continued = strings.HasSuffix(line, `\`)
+			continue
+		}
+
+		if entry, ok := parseZshHistoryLine(line); ok {
+			flush()
+			current = &entry
+			continued = strings.HasSuffix(line, `\`)
+			if continued {
+				current.command = strings.TrimSuffix(current.command, `\`)
+			}
+			continue
+		}
+		if epoch, ok := parseBashTimestamp(line); ok {
+			flush()
+			current = &historyEntry{start: time.Unix(epoch, 0).UTC()}
+			continue
+		}
+		if current != nil && !current.hasDuration {
+			if current.command != "" {
+				current.command += "\n"
+			}
+			current.command += line
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			skipped++
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, skipped, err
+	}
+	return out, skipped, nil
+}
+
+func parseZshHistoryLine(line string) (historyEntry, bool) {
+	if !strings.HasPrefix(line, ": ") {
+		return historyEntry{}, false
+	}
+	meta, command, ok := strings.Cut(line[2:], ";")
+	if !ok {
+		return historyEntry{}, false
+	}
+	epochStr, durationStr, ok := strings.Cut(meta, ":")
+	if !ok {
+		return historyEntry{}, false
+	}
+	epoch, err := strconv.ParseInt(epochStr, 10, 64)
+	if err != nil {
+		return historyEntry{}, false
+	}
+	seconds, err := strconv.ParseInt(durationStr, 10, 64)
+	if err != nil || seconds < 0 {
+		return historyEntry{}, false
+	}
+	return historyEntry{
+		start:       time.Unix(epoch, 0).UTC(),
+		duration:    time.Duration(seconds) * time.Second,
+		hasDuration: true,
+		command:     command,
+	}, true
+}
+
+func parseBashTimestamp(line string) (int64, bool) {
+	if len(line) < 2 || line[0] != '#' {
+		return 0, false
+	}
+	epoch, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil || epoch <= 0 {
+		return 0, false
+	}
+	return epoch, true
+}
+
+func unmetafy(b []byte) string {
+	if bytes.IndexByte(b, 0x83) < 0 {
+		return string(b)
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] == 0x83 && i+1 < len(b) {
+			i++
+			out = append(out, b[i]^0x20)
+			continue
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+type cwdTracker struct {
+	home     string
+	current  string
+	previous string
+	enabled  bool
+}
+
+func (t *cwdTracker) observe(command string) {
+	if !t.enabled {
+		return
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 || fields[0] != "cd" || len(fields) > 2 {
+		return
+	}
+	target := t.home
+	if len(fields) == 2 {
+		target = fields[1]
+	}
+	switch {
+	case target == "-":
+		if t.previous == "" {
+			return
+		}
+		target = t.previous
+	case target == "~" || strings.HasPrefix(target, "~/"):
+		target = t.home + target[1:]
+	case strings.ContainsAny(target, "$`*?"):
+		return
+	case !filepath.IsAbs(target):
+		target = filepath.Join(t.current, target)
+	}
+	t.previous = t.current
+	t.current = filepath.Clean(target)
+}
+
+func historyEvents(entries []historyEntry, cwd *cwdTracker) [][]byte {
+	seen := make(map[string]int)
+	out := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		key := fmt.Sprintf("shell-history\x00%d\x00%s", entry.start.Unix(), entry.command)
+		seen[key]++
+		id := uuid.NewSHA1(importNamespace, []byte(fmt.Sprintf("%s\x00%d", key, seen[key])))
+
+		ev := events.Event{
+			Type:          "terminal_command",
+			Source:        importSource,
+			EventID:       id.String(),
+			SchemaVersion: events.LatestSchemaVersion,
+			StartTS:       entry.start.Format(time.RFC3339),
+			EndTS:         entry.start.Add(entry.duration).Format(time.RFC3339),
+			CWD:           cwd.current,
+			Command:       entry.command,
+		}
+		if entry.hasDuration {
+			durationMS := entry.duration.Milliseconds()
+			ev.DurationMS = &durationMS
+		}
+		data, _ := json.Marshal(ev)
+		out = append(out, data)
+		cwd.observe(entry.command)
+	}
+	return out
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -17,124 +16,44 @@ import (
 	"strings"
 	"time"
 
+	"devlog-report/internal/events"
 	"github.com/mattn/go-runewidth"
-	"gopkg.in/yaml.v3"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
-type Event struct {
-	Type          string `json:"type"`
-	Source        string `json:"source"`
-	EventID       string `json:"event_id"`
-	SchemaVersion int    `json:"schema_version"`
-
-	StartTS string `json:"start_ts,omitempty"`
-	EndTS   string `json:"end_ts,omitempty"`
-
-	URL   string `json:"url,omitempty"`
-	Title string `json:"title,omitempty"`
-
-	CWD     string `json:"cwd,omitempty"`
-	Command string `json:"command,omitempty"`
-}
-
-func normalizeEvent(b []byte) (Event, error) {
-	var ev Event
-	dec := json.NewDecoder(bytes.NewReader(b))
-	dec.DisallowUnknownFields()
-	if err := dec.Decode(&ev); err != nil {
-		return Event{}, err
-	}
-
-	if err := validateEvent(ev); err != nil {
-		return Event{}, err
-	}
-
-	if ev.Type == "terminal_command" {
-		ev.EndTS = ev.StartTS
-	}
-
-	return ev, nil
+type eventStore struct {
+	db *sql.DB
 }
 
-func validateEvent(ev Event) error {
-	if ev.Type == "" {
-		return errors.New("type is required")
-	}
-	if ev.Source == "" {
-		return errors.New("source is required")
-	}
-	if ev.EventID == "" {
-		return errors.New("event_id is required")
-	}
-	if ev.SchemaVersion == 0 {
-		return errors.New("schema_version is required")
-	}
-	if ev.StartTS == "" || ev.EndTS == "" {
-		return errors.New("start_ts and end_ts are required")
-	}
-	if err := parseTime(ev.StartTS); err != nil {
-		return errors.New("start_ts must be RFC3339")
-	}
-	if err := parseTime(ev.EndTS); err != nil {
-		return errors.New("end_ts must be RFC3339")
-	}
-
-	switch ev.Type {
-	case "browser_active_span":
-		if ev.URL == "" {
-			return errors.New("url is required for browser_active_span")
-		}
-		if ev.Title == "" {
-			return errors.New("title is required for browser_active_span")
-		}
-	case "terminal_command":
-		if ev.CWD == "" {
-			return errors.New("cwd is required for terminal_command")
-		}
-		if ev.Command == "" {
-			return errors.New("command is required for terminal_command")
-		}
-	default:
-		return errors.New("unknown type")
-	}
-
-	return nil
+type span struct {
+	minStart  time.Time
+	maxEnd    time.Time
+	intervals []interval
 }
 
-func parseTime(value string) error {
-	if value == "" {
-		return errors.New("empty time")
-	}
-	if _, err := time.Parse(time.RFC3339Nano, value); err == nil {
-		return nil
-	}
-	_, err := time.Parse(time.RFC3339, value)
-	return err
+type ProjectsConfig struct {
+	Projects []ProjectConfig `yaml:"projects"`
+	Output   OutputConfig    `yaml:"output"`
+	Privacy  PrivacyConfig   `yaml:"privacy"`
 }
 
-func parseTimeValue(value string) (time.Time, error) {
-	if value == "" {
-		return time.Time{}, errors.New("empty time")
-	}
-	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
-		return t, nil
-	}
-	return time.Parse(time.RFC3339, value)
+type OutputConfig struct {
+	IncludeOther *bool  `yaml:"include_other"`
+	OtherName    string `yaml:"other_name"`
 }
 
-type eventStore struct {
-	db *sql.DB
-}
+const defaultOtherName = "Other"
 
-type span struct {
-	minStart time.Time
-	maxEnd   time.Time
-	seconds  int64
+func (c OutputConfig) otherName() string {
+	if name := strings.TrimSpace(c.OtherName); name != "" {
+		return name
+	}
+	return defaultOtherName
 }
 
-type ProjectsConfig struct {
-	Projects []ProjectConfig `yaml:"projects"`
+func (c OutputConfig) includeOther() bool {
+	return c.IncludeOther == nil || *c.IncludeOther
 }
 
 type ProjectConfig struct {
@@ -149,167 +68,153 @@ type ProjectMatch struct {
 
 type BrowserMatch struct {
 	Title []string `yaml:"title"`
+	URL   []string `yaml:"url"`
 }
 
 type TerminalMatch struct {
-	CWD []string `yaml:"cwd"`
+	CWD     []string `yaml:"cwd"`
+	Command []string `yaml:"command"`
 }
 
 type compiledProject struct {
 	name           string
 	browserTitleRe []*regexp.Regexp
+	browserURLRe   []*regexp.Regexp
 	terminalCwdRe  []*regexp.Regexp
+	terminalCmdRe  []*regexp.Regexp
+}
+
+type browserKey struct {
+	title string
+	url   string
+}
+
+type terminalKey struct {
+	cwd     string
+	command string
 }
 
 func newEventStore(path string) (*eventStore, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, err
 	}
-	db, err := sql.Open("sqlite", path)
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, err
 	}
-	if err := initSchema(db); err != nil {
-		_ = db.Close()
-		return nil, err
-	}
 	return &eventStore{db: db}, nil
 }
 
-func initSchema(db *sql.DB) error {
-	_, err := db.Exec(`
-CREATE TABLE IF NOT EXISTS events (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	event_id TEXT NOT NULL UNIQUE,
-	type TEXT NOT NULL,
-	source TEXT NOT NULL,
-	schema_version INTEGER NOT NULL,
-	start_ts TEXT NOT NULL,
-	end_ts TEXT NOT NULL,
-	url TEXT,
-	title TEXT,
-	cwd TEXT,
-	command TEXT,
-	payload TEXT NOT NULL,
-	received_at TEXT NOT NULL
-);
-`)
-	return err
+var errDuplicateEvent = errors.New("event_id already exists")
+
+type dbHandle interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
-func (s *eventStore) insert(ev Event, payload string) error {
-	receivedAt := time.Now().UTC().Format(time.RFC3339Nano)
-	_, err := s.db.Exec(`
-INSERT INTO events (
-	event_id, type, source, schema_version, start_ts, end_ts,
-	url, title, cwd, command, payload, received_at
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-`,
-		ev.EventID, ev.Type, ev.Source, ev.SchemaVersion, ev.StartTS, ev.EndTS,
-		ev.URL, ev.Title, ev.CWD, ev.Command, payload, receivedAt,
-	)
-	if err != nil && strings.Contains(err.Error(), "UNIQUE") {
-		return errors.New("event_id already exists")
-	}
-	return err
+func (s *eventStore) insert(ev events.Event, payload string) error {
+	return insertEvent(s.db, ev, payload, time.Now())
 }
 
-func (s *eventStore) migrateSchemaV2() (bool, error) {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return false, err
+func insertEvent(db dbHandle, ev events.Event, payload string, receivedAt time.Time) error {
+	var compacted int
+	err := db.QueryRow(`SELECT 1 FROM compacted_events WHERE event_id = ?`, ev.EventID).Scan(&compacted)
+	if err == nil {
+		return errDuplicateEvent
 	}
-
-	var exists int
-	if err := tx.QueryRow(`SELECT 1 FROM events WHERE schema_version = 1 LIMIT 1`).Scan(&exists); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			_ = tx.Rollback()
-			return false, nil
-		}
-		_ = tx.Rollback()
-		return false, err
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
 	}
 
-	if _, err := tx.Exec(`
-UPDATE events
-SET end_ts = start_ts
-WHERE schema_version = 1 AND type = 'terminal_command'
-`); err != nil {
-		_ = tx.Rollback()
-		return false, err
+	startTime, err := events.ParseTime(ev.StartTS)
+	if err != nil {
+		return err
 	}
-
-	if _, err := tx.Exec(`
-UPDATE events
-SET schema_version = 2
-WHERE schema_version = 1
-`); err != nil {
-		_ = tx.Rollback()
-		return false, err
+	endTime, err := events.ParseTime(ev.EndTS)
+	if err != nil {
+		return err
 	}
-
-	if err := tx.Commit(); err != nil {
-		return false, err
+	_, err = db.Exec(`
+INSERT INTO events (
+	event_id, type, source, schema_version, start_ts, end_ts, start_ms, end_ms,
+	url, title, cwd, command, exit_code, duration_ms, payload, received_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`,
+		ev.EventID, ev.Type, ev.Source, ev.SchemaVersion, ev.StartTS, ev.EndTS, startTime.UnixMilli(), endTime.UnixMilli(),
+		ev.URL, ev.Title, ev.CWD, ev.Command, ev.ExitCode, ev.DurationMS, payload, receivedAt.UTC().Format(time.RFC3339Nano),
+	)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return errDuplicateEvent
 	}
-	return true, nil
+	return err
 }
 
-func (s *eventStore) terminalDurationsByCWD(date string) (map[string]span, error) {
+func (s *eventStore) terminalDurationsByCommand(window dayWindow) (map[terminalKey]span, error) {
 	rows, err := s.db.Query(`
-SELECT cwd, MIN(start_ts), MAX(end_ts)
+SELECT cwd, command, start_ts, end_ts
 FROM events
-WHERE type = 'terminal_command' AND date(start_ts, 'localtime') = ?
-GROUP BY cwd
-`, date)
+WHERE `+windowOverlapCondition+`
+`, window.overlapParams("terminal_command")...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	out := make(map[string]span)
+	out := make(map[terminalKey]span)
 	for rows.Next() {
 		var cwd string
-		var minStart string
-		var maxEnd string
-		if err := rows.Scan(&cwd, &minStart, &maxEnd); err != nil {
+		var command string
+		var startStr string
+		var endStr string
+		if err := rows.Scan(&cwd, &command, &startStr, &endStr); err != nil {
 			return nil, err
 		}
-		startTime, err := parseTimeValue(minStart)
+		startTime, err := events.ParseTime(startStr)
 		if err != nil {
 			return nil, err
 		}
-		endTime, err := parseTimeValue(maxEnd)
+		endTime, err := events.ParseTime(endStr)
 		if err != nil {
 			return nil, err
 		}
-		secs := int64(endTime.Sub(startTime).Seconds())
-		if secs < 0 {
-			secs = 0
-		}
-		out[cwd] = span{
-			minStart: startTime,
-			maxEnd:   endTime,
-			seconds:  secs,
-		}
+		startTime, endTime = window.clip(startTime, endTime)
+		key := terminalKey{cwd: cwd, command: command}
+		updateSpanAgg(out, key, span{
+			minStart:  startTime,
+			maxEnd:    endTime,
+			intervals: []interval{{start: startTime, end: endTime}},
+		})
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+
+	err = s.rollupIntervals(window, "terminal_command", func(key rollupKey, value interval) {
+		updateSpanAgg(out, terminalKey{cwd: key.cwd, command: key.command}, span{
+			minStart:  value.start,
+			maxEnd:    value.end,
+			intervals: []interval{value},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
-func (s *eventStore) browserDurationsByTitle(date string) (map[string]int64, error) {
+func (s *eventStore) browserDurationsByTitle(window dayWindow) (map[browserKey][]interval, error) {
 	rows, err := s.db.Query(`
 SELECT title, url, start_ts, end_ts
 FROM events
-WHERE type = 'browser_active_span' AND date(start_ts, 'localtime') = ?
-`, date)
+WHERE `+windowOverlapCondition+`
+`, window.overlapParams("browser_active_span")...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	out := make(map[string]int64)
+	out := make(map[browserKey][]interval)
 	for rows.Next() {
 		var title string
 		var url string
@@ -322,23 +227,29 @@ WHERE type = 'browser_active_span' AND date(start_ts, 'localtime') = ?
 		if key == "" {
 			key = url
 		}
-		startTime, err := parseTimeValue(startStr)
+		startTime, err := events.ParseTime(startStr)
 		if err != nil {
 			return nil, err
 		}
-		endTime, err := parseTimeValue(endStr)
+		endTime, err := events.ParseTime(endStr)
 		if err != nil {
 			return nil, err
 		}
-		secs := int64(endTime.Sub(startTime).Seconds())
-		if secs < 0 {
-			secs = 0
-		}
-		out[key] += secs
+		startTime, endTime = window.clip(startTime, endTime)
+		bkey := browserKey{title: key, url: url}
+		out[bkey] = append(out[bkey], interval{start: startTime, end: endTime})
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+
+	err = s.rollupIntervals(window, "browser_active_span", func(key rollupKey, value interval) {
+		bkey := browserKey{title: key.title, url: key.url}
+		out[bkey] = append(out[bkey], value)
+	})
+	if err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
@@ -371,8 +282,9 @@ func loadProjectsConfig(path string) (ProjectsConfig, error) {
 	if err != nil {
 		return cfg, err
 	}
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return cfg, err
+	cfg, problems := validateProjectsConfig(data)
+	if len(problems) > 0 {
+		return cfg, &configError{problems: problems}
 	}
 	return cfg, nil
 }
@@ -390,6 +302,14 @@ func compileProjectMatchers(cfg ProjectsConfig) ([]compiledProject, error) {
 			entry.browserTitleRe = append(entry.browserTitleRe, re)
 		}
 
+		for _, pattern := range project.Match.Browser.URL {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			entry.browserURLRe = append(entry.browserURLRe, re)
+		}
+
 		for _, pattern := range project.Match.Terminal.CWD {
 			re, err := regexp.Compile(pattern)
 			if err != nil {
@@ -398,16 +318,90 @@ func compileProjectMatchers(cfg ProjectsConfig) ([]compiledProject, error) {
 			entry.terminalCwdRe = append(entry.terminalCwdRe, re)
 		}
 
+		for _, pattern := range project.Match.Terminal.Command {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			entry.terminalCmdRe = append(entry.terminalCmdRe, re)
+		}
+
 		compiled = append(compiled, entry)
 	}
 	return compiled, nil
 }
 
-func classifyProjects(
-	terminal map[string]span,
-	browser map[string]int64,
-	cfg ProjectsConfig,
-) (map[string]int64, map[string]map[string]int64, error) {
+func matchBrowserProject(compiled []compiledProject, key browserKey) (string, bool) {
+	for _, project := range compiled {
+		for _, re := range project.browserTitleRe {
+			if re.MatchString(key.title) {
+				return project.name, true
+			}
+		}
+		for _, re := range project.browserURLRe {
+			if re.MatchString(key.url) {
+				return project.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func matchTerminalProject(compiled []compiledProject, key terminalKey) (string, bool) {
+	for _, project := range compiled {
+		for _, re := range project.terminalCwdRe {
+			if re.MatchString(key.cwd) {
+				return project.name, true
+			}
+		}
+		for _, re := range project.terminalCmdRe {
+			if re.MatchString(key.command) {
+				return project.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func updateSpanAgg[K comparable](agg map[K]span, name K, entry span) {
+	current, ok := agg[name]
+	if !ok {
+		current = span{minStart: entry.minStart, maxEnd: entry.maxEnd}
+	} else {
+		if entry.minStart.Before(current.minStart) {
+			current.minStart = entry.minStart
+		}
+		if entry.maxEnd.After(current.maxEnd) {
+			current.maxEnd = entry.maxEnd
+		}
+	}
+	current.intervals = append(current.intervals, entry.intervals...)
+	agg[name] = current
+}
+
+func terminalSpansByCWD(values map[terminalKey]span) map[string]span {
+	out := make(map[string]span)
+	for key, entry := range values {
+		updateSpanAgg(out, key.cwd, entry)
+	}
+	return out
+}
+
+type projectTimeline struct {
+	totals  map[string]int64
+	others  map[string]map[string]int64
+	claims  []claim
+	tracked trackedTime
+}
+
+func buildProjectTimeline(
+	terminal map[terminalKey]span,
+	browser map[browserKey][]interval,
+	projects *projectsSnapshot,
+	model terminalModel,
+) projectTimeline {
+	cfg := projects.cfg
+	compiled := projects.compiled
 	projectTotals := make(map[string]int64)
 	project_others := map[string]map[string]int64{
 		"browser":  {},
@@ -418,93 +412,103 @@ func classifyProjects(
 		projectTotals[project.Name] = 0
 	}
 
-	const otherName = "Other"
+	otherName := cfg.Output.otherName()
 	projectTotals[otherName] = 0
 
-	compiled, err := compileProjectMatchers(cfg)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	terminalAgg := make(map[string]span)
 	browserAgg := make(map[string]int64)
-	terminalOtherSum := int64(0)
+	terminalOtherByCWD := make(map[string]span)
+
+	var claims []claim
+	var tracked trackedTime
 
-	updateAgg := func(agg map[string]span, name string, entry span) map[string]span {
-		current, ok := agg[name]
+	assignBrowser := func(key browserKey, intervals []interval) {
+		seconds := sumIntervalSeconds(intervals)
+		tracked.browser += seconds
+		name, ok := matchBrowserProject(compiled, key)
 		if !ok {
-			agg[name] = span{
-				minStart: entry.minStart,
-				maxEnd:   entry.maxEnd,
-			}
-			return agg
-		}
-		if entry.minStart.Before(current.minStart) {
-			current.minStart = entry.minStart
-		}
-		if entry.maxEnd.After(current.maxEnd) {
-			current.maxEnd = entry.maxEnd
+			name = otherName
+			project_others["browser"][key.title] += seconds
 		}
-		agg[name] = current
-		return agg
-	}
-
-	assignBrowser := func(title string, seconds int64) {
-		for _, project := range compiled {
-			for _, re := range project.browserTitleRe {
-				if re.MatchString(title) {
-					browserAgg[project.name] += seconds
-					return
-				}
-			}
+		browserAgg[name] += seconds
+		for _, iv := range intervals {
+			claims = append(claims, claim{project: name, source: sourceBrowser, interval: iv})
 		}
-		browserAgg[otherName] += seconds
-		project_others["browser"][title] += seconds
 	}
 
-	assignTerminal := func(cwd string, entry span) {
-		for _, project := range compiled {
-			for _, re := range project.terminalCwdRe {
-				if re.MatchString(cwd) {
-					terminalAgg = updateAgg(terminalAgg, project.name, entry)
-					return
-				}
-			}
+	assignTerminal := func(key terminalKey, entry span) {
+		if name, ok := matchTerminalProject(compiled, key); ok {
+			updateSpanAgg(terminalAgg, name, entry)
+			return
 		}
-		terminalAgg = updateAgg(terminalAgg, otherName, entry)
-		project_others["terminal"][cwd] += entry.seconds
-		terminalOtherSum += entry.seconds
+		updateSpanAgg(terminalOtherByCWD, key.cwd, entry)
 	}
 
-	for title, seconds := range browser {
-		assignBrowser(title, seconds)
+	for key, intervals := range browser {
+		assignBrowser(key, intervals)
 	}
 
-	for cwd, entry := range terminal {
-		assignTerminal(cwd, entry)
+	for key, entry := range terminal {
+		assignTerminal(key, entry)
 	}
 
-	durationFromAgg := func(entry span, ok bool) int64 {
-		if !ok {
-			return 0
-		}
-		secs := int64(entry.maxEnd.Sub(entry.minStart).Seconds())
-		if secs < 0 {
-			return 0
+	terminalOtherSum := int64(0)
+	for cwd, entry := range terminalOtherByCWD {
+		seconds := model.spanSeconds(entry)
+		project_others["terminal"][cwd] = seconds
+		terminalOtherSum += seconds
+		for _, iv := range model.intervalsOf(entry) {
+			claims = append(claims, claim{project: otherName, source: sourceTerminal, interval: iv})
 		}
-		return secs
 	}
+	tracked.terminal += terminalOtherSum
 
 	for name := range projectTotals {
-		terminalEntry, okTerminal := terminalAgg[name]
-		terminalSeconds := durationFromAgg(terminalEntry, okTerminal)
+		terminalSeconds := int64(0)
+		if entry, ok := terminalAgg[name]; ok {
+			terminalSeconds = model.spanSeconds(entry)
+			tracked.terminal += terminalSeconds
+			for _, iv := range model.intervalsOf(entry) {
+				claims = append(claims, claim{project: name, source: sourceTerminal, interval: iv})
+			}
+		}
 		if name == otherName {
 			terminalSeconds = terminalOtherSum
 		}
 		projectTotals[name] = terminalSeconds + browserAgg[name]
 	}
 
-	return projectTotals, project_others, nil
+	return projectTimeline{totals: projectTotals, others: project_others, claims: claims, tracked: tracked}
+}
+
+func (t projectTimeline) resolve(output OutputConfig, overlap string) (map[string]int64, map[string]map[string]int64, trackedTime) {
+	projectTotals := t.totals
+	tracked := t.tracked
+	resolved, trackedSeconds := resolveTimeline(t.claims, overlap)
+	tracked.tracked = trackedSeconds
+	if overlap != overlapNone {
+		for name := range projectTotals {
+			projectTotals[name] = resolved[name]
+		}
+	}
+
+	if !output.includeOther() {
+		delete(projectTotals, output.otherName())
+		return projectTotals, nil, tracked
+	}
+
+	return projectTotals, t.others, tracked
+}
+
+func classifyProjects(
+	terminal map[terminalKey]span,
+	browser map[browserKey][]interval,
+	projects *projectsSnapshot,
+	model terminalModel,
+	overlap string,
+) (map[string]int64, map[string]map[string]int64, trackedTime) {
+	timeline := buildProjectTimeline(terminal, browser, projects, model)
+	return timeline.resolve(projects.cfg.Output, overlap)
 }
 
 type projectRow struct {
@@ -541,13 +545,17 @@ func ceilMinutes(seconds int64) int64 {
 }
 
 func drillDownRows(
-	terminal map[string]span,
-	browser map[string]int64,
-	cfg ProjectsConfig,
+	terminal map[terminalKey]span,
+	browser map[browserKey][]interval,
+	projects *projectsSnapshot,
+	model terminalModel,
+	overlap string,
 	projectName string,
-) ([]drillDownRow, int64, bool, error) {
-	const otherName = "Other"
-	projectExists := projectName == otherName
+) ([]drillDownRow, int64, bool) {
+	cfg := projects.cfg
+	compiled := projects.compiled
+	otherName := cfg.Output.otherName()
+	projectExists := cfg.Output.includeOther() && projectName == otherName
 	for _, project := range cfg.Projects {
 		if project.Name == projectName {
 			projectExists = true
@@ -555,85 +563,137 @@ func drillDownRows(
 		}
 	}
 	if !projectExists {
-		return nil, 0, false, nil
-	}
-
-	compiled, err := compileProjectMatchers(cfg)
-	if err != nil {
-		return nil, 0, false, err
+		return nil, 0, false
 	}
 
-	matchBrowser := func(title string) string {
-		for _, project := range compiled {
-			for _, re := range project.browserTitleRe {
-				if re.MatchString(title) {
-					return project.name
-				}
-			}
+	matchBrowser := func(key browserKey) string {
+		if name, ok := matchBrowserProject(compiled, key); ok {
+			return name
 		}
 		return otherName
 	}
 
-	matchTerminal := func(cwd string) string {
-		for _, project := range compiled {
-			for _, re := range project.terminalCwdRe {
-				if re.MatchString(cwd) {
-					return project.name
-				}
-			}
+	matchTerminal := func(key terminalKey) string {
+		if name, ok := matchTerminalProject(compiled, key); ok {
+			return name
 		}
 		return otherName
 	}
 
 	var rows []drillDownRow
-	var terminalAgg span
-	var terminalOK bool
-	var browserTotal int64
-	for title, seconds := range browser {
-		if matchBrowser(title) == projectName {
-			rows = append(rows, drillDownRow{
-				name:    title,
-				typ:     "browser",
-				minTS:   "",
-				maxTS:   "",
-				seconds: seconds,
-			})
-			browserTotal += seconds
-		}
-	}
-	for cwd, entry := range terminal {
-		if matchTerminal(cwd) == projectName {
-			rows = append(rows, drillDownRow{
-				name:    cwd,
-				typ:     "terminal",
-				minTS:   entry.minStart.Format(time.RFC3339Nano),
-				maxTS:   entry.maxEnd.Format(time.RFC3339Nano),
-				seconds: entry.seconds,
-			})
-			if !terminalOK {
-				terminalAgg = span{minStart: entry.minStart, maxEnd: entry.maxEnd}
-				terminalOK = true
-			} else {
-				if entry.minStart.Before(terminalAgg.minStart) {
-					terminalAgg.minStart = entry.minStart
-				}
-				if entry.maxEnd.After(terminalAgg.maxEnd) {
-					terminalAgg.maxEnd = entry.maxEnd
-				}
-			}
+	browserByTitle := make(map[string]int64)
+	for key, intervals := range browser {
+		if matchBrowser(key) == projectName {
+			browserByTitle[key.title] += sumIntervalSeconds(intervals)
+		}
+	}
+	for title, seconds := range browserByTitle {
+		rows = append(rows, drillDownRow{
+			name:    title,
+			typ:     "browser",
+			minTS:   "",
+			maxTS:   "",
+			seconds: seconds,
+		})
+	}
+	terminalByCWD := make(map[string]span)
+	for key, entry := range terminal {
+		if matchTerminal(key) == projectName {
+			updateSpanAgg(terminalByCWD, key.cwd, entry)
+		}
+	}
+	for cwd, entry := range terminalByCWD {
+		rows = append(rows, drillDownRow{
+			name:    cwd,
+			typ:     "terminal",
+			minTS:   entry.minStart.Format(time.RFC3339Nano),
+			maxTS:   entry.maxEnd.Format(time.RFC3339Nano),
+			seconds: model.spanSeconds(entry),
+		})
+	}
+
+	timeline := buildProjectTimeline(terminal, browser, projects, model)
+	totals, _, _ := timeline.resolve(cfg.Output, overlap)
+	total := totals[projectName]
+	if overlap != overlapNone {
+		resolveDrillDownRows(rows, timeline.claims, overlap, projectName, total)
+	}
+
+	return rows, total, true
+}
+
+// resolveDrillDownRows spreads the resolved project total over the rows for
+// display: the browser/terminal split comes from the same timeline as the
+// total, and within a source each row keeps its unresolved share.
+func resolveDrillDownRows(rows []drillDownRow, claims []claim, overlap string, projectName string, total int64) {
+	bySource := make([]claim, len(claims))
+	for i, c := range claims {
+		if c.project == projectName {
+			c.project = projectName + "\x00" + c.source
 		}
+		bySource[i] = c
 	}
+	resolved, _ := resolveTimeline(bySource, overlap)
 
-	var total int64
-	if terminalOK {
-		secs := int64(terminalAgg.maxEnd.Sub(terminalAgg.minStart).Seconds())
-		if secs > 0 {
-			total += secs
+	var browserRows, terminalRows []int
+	for i, row := range rows {
+		if row.typ == "browser" {
+			browserRows = append(browserRows, i)
+		} else {
+			terminalRows = append(terminalRows, i)
 		}
 	}
-	total += browserTotal
+	browserSeconds := min(resolved[projectName+"\x00"+sourceBrowser], total)
+	switch {
+	case len(terminalRows) == 0:
+		browserSeconds = total
+	case len(browserRows) == 0:
+		browserSeconds = 0
+	}
+	distributeSeconds(rows, browserRows, browserSeconds)
+	distributeSeconds(rows, terminalRows, total-browserSeconds)
+}
+
+func distributeSeconds(rows []drillDownRow, indexes []int, seconds int64) {
+	if len(indexes) == 0 {
+		return
+	}
+	var weightSum int64
+	for _, i := range indexes {
+		weightSum += rows[i].seconds
+	}
+	weight := func(i int) int64 {
+		if weightSum == 0 {
+			return 1
+		}
+		return rows[i].seconds
+	}
+	if weightSum == 0 {
+		weightSum = int64(len(indexes))
+	}
 
-	return rows, total, true, nil
+	remainders := make(map[int]int64, len(indexes))
+	shares := make(map[int]int64, len(indexes))
+	assigned := int64(0)
+	for _, i := range indexes {
+		shares[i] = seconds * weight(i) / weightSum
+		remainders[i] = seconds * weight(i) % weightSum
+		assigned += shares[i]
+	}
+	order := append([]int(nil), indexes...)
+	sort.Slice(order, func(a, b int) bool {
+		if remainders[order[a]] != remainders[order[b]] {
+			return remainders[order[a]] > remainders[order[b]]
+		}
+		return rows[order[a]].name < rows[order[b]].name
+	})
+	for k := 0; assigned < seconds; k++ {
+		shares[order[k%len(order)]]++
+		assigned++
+	}
+	for _, i := range indexes {
+		rows[i].seconds = shares[i]
+	}
 }
 
 func padRightWidth(value string, width int) string {
@@ -656,10 +716,18 @@ func padLeftWidth(value string, width int) string {
 	return strings.Repeat(" ", width-runewidth.StringWidth(value)) + value
 }
 
-func spansToSeconds(values map[string]span) map[string]int64 {
+func browserSecondsByTitle(values map[browserKey][]interval) map[string]int64 {
+	out := make(map[string]int64, len(values))
+	for key, intervals := range values {
+		out[key.title] += sumIntervalSeconds(intervals)
+	}
+	return out
+}
+
+func spansToSeconds(values map[string]span, model terminalModel) map[string]int64 {
 	out := make(map[string]int64, len(values))
 	for key, entry := range values {
-		out[key] = entry.seconds
+		out[key] = model.spanSeconds(entry)
 	}
 	return out
 }
@@ -667,6 +735,7 @@ func spansToSeconds(values map[string]span) map[string]int64 {
 func renderStatsMarkdown(
 	projects map[string]int64,
 	projectOthers map[string]map[string]int64,
+	tracked trackedTime,
 ) string {
 	projectRows := make([]projectRow, 0, len(projects))
 	for name, seconds := range projects {
@@ -679,22 +748,6 @@ func renderStatsMarkdown(
 		return projectRows[i].name < projectRows[j].name
 	})
 
-	otherRows := make([]otherRow, 0)
-	for typ, items := range projectOthers {
-		for name, seconds := range items {
-			otherRows = append(otherRows, otherRow{name: name, typ: typ, seconds: seconds})
-		}
-	}
-	sort.Slice(otherRows, func(i, j int) bool {
-		if otherRows[i].seconds != otherRows[j].seconds {
-			return otherRows[i].seconds > otherRows[j].seconds
-		}
-		if otherRows[i].name != otherRows[j].name {
-			return otherRows[i].name < otherRows[j].name
-		}
-		return otherRows[i].typ < otherRows[j].typ
-	})
-
 	var b strings.Builder
 	b.WriteString("# Project Summary\n\n")
 	b.WriteString("| Project")
@@ -714,6 +767,42 @@ func renderStatsMarkdown(
 		b.WriteString(" |\n")
 	}
 
+	writeTrackedMarkdown(&b, tracked)
+
+	if projectOthers != nil {
+		writeOthersMarkdown(&b, projectOthers)
+	}
+
+	return b.String()
+}
+
+func writeTrackedMarkdown(b *strings.Builder, tracked trackedTime) {
+	b.WriteString("\nTracked: ")
+	b.WriteString(strconv.FormatInt(ceilMinutes(tracked.tracked), 10))
+	b.WriteString(" min (browser ")
+	b.WriteString(strconv.FormatInt(ceilMinutes(tracked.browser), 10))
+	b.WriteString(" min, terminal ")
+	b.WriteString(strconv.FormatInt(ceilMinutes(tracked.terminal), 10))
+	b.WriteString(" min)\n")
+}
+
+func writeOthersMarkdown(b *strings.Builder, projectOthers map[string]map[string]int64) {
+	otherRows := make([]otherRow, 0)
+	for typ, items := range projectOthers {
+		for name, seconds := range items {
+			otherRows = append(otherRows, otherRow{name: name, typ: typ, seconds: seconds})
+		}
+	}
+	sort.Slice(otherRows, func(i, j int) bool {
+		if otherRows[i].seconds != otherRows[j].seconds {
+			return otherRows[i].seconds > otherRows[j].seconds
+		}
+		if otherRows[i].name != otherRows[j].name {
+			return otherRows[i].name < otherRows[j].name
+		}
+		return otherRows[i].typ < otherRows[j].typ
+	})
+
 	b.WriteString("\n")
 	b.WriteString("# Others List\n\n")
 	b.WriteString("| Others")
@@ -739,8 +828,6 @@ func renderStatsMarkdown(
 		b.WriteString(padLeftWidth(strconv.FormatInt(ceilMinutes(row.seconds), 10), markdownTimeWidth))
 		b.WriteString(" |\n")
 	}
-
-	return b.String()
 }
 
 func renderDrillDownMarkdown(projectName string, totalSeconds int64, rows []drillDownRow) string {
@@ -790,19 +877,77 @@ func renderDrillDownMarkdown(projectName string, totalSeconds int64, rows []dril
 	return b.String()
 }
 
+func writeDrillDown(w http.ResponseWriter, r *http.Request, projectName string, totalSeconds int64, rows []drillDownRow) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].seconds != rows[j].seconds {
+			return rows[i].seconds > rows[j].seconds
+		}
+		if rows[i].name != rows[j].name {
+			return rows[i].name < rows[j].name
+		}
+		return rows[i].typ < rows[j].typ
+	})
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" || mode == "md" {
+		body := renderDrillDownMarkdown(projectName, totalSeconds, rows)
+		writeMarkdown(w, http.StatusOK, body)
+		return
+	}
+	if mode != "json" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mode must be 'json' or 'md'"})
+		return
+	}
+
+	type drillDownItem struct {
+		TitleCWD   string `json:"title/cwd"`
+		Type       string `json:"type"`
+		MinStartTS string `json:"min_start_ts"`
+		MaxEndTS   string `json:"max_end_ts"`
+		Seconds    int64  `json:"seconds"`
+	}
+
+	list := make([]drillDownItem, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, drillDownItem{
+			TitleCWD:   row.name,
+			Type:       row.typ,
+			MinStartTS: row.minTS,
+			MaxEndTS:   row.maxTS,
+			Seconds:    row.seconds,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":    projectName,
+		"seconds": totalSeconds,
+		"list":    list,
+	})
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	addr := envOr("DEVLOG_ADDR", "127.0.0.1:8787")
 	dbPath := envOr("DEVLOG_DB_PATH", "./data/devlog.db")
 	projectsPath := envOr("DEVLOG_PROJECTS_PATH", "./projects.yaml")
+	projectsPoll, err := time.ParseDuration(envOr("DEVLOG_PROJECTS_POLL", "2s"))
+	if err != nil {
+		log.Fatalf("invalid DEVLOG_PROJECTS_POLL: %v", err)
+	}
 
 	store, err := newEventStore(dbPath)
 	if err != nil {
 		log.Fatalf("failed to open event store: %v", err)
 	}
-	if migrated, err := store.migrateSchemaV2(); err != nil {
+	applied, err := migrateUp(store.db)
+	for _, migration := range applied {
+		log.Printf("migration: applied %d %s", migration.version, migration.name)
+	}
+	if err != nil {
 		log.Fatalf("failed to migrate events: %v", err)
-	} else if migrated {
-		log.Printf("migration: schema_version 1 -> 2 completed")
 	}
 	defer func() {
 		if err := store.close(); err != nil {
@@ -810,13 +955,76 @@ func main() {
 		}
 	}()
 
+	defaultDayOpts, err := loadDayOptions(envOr("DEVLOG_TZ", ""), envOr("DEVLOG_DAY_START", "00:00"))
+	if err != nil {
+		log.Fatalf("invalid DEVLOG_TZ/DEVLOG_DAY_START: %v", err)
+	}
+
+	retentionDays, err := strconv.Atoi(envOr("DEVLOG_RETENTION_DAYS", "0"))
+	if err != nil || retentionDays < 0 {
+		log.Fatalf("invalid DEVLOG_RETENTION_DAYS: %q", os.Getenv("DEVLOG_RETENTION_DAYS"))
+	}
+	retentionInterval, err := time.ParseDuration(envOr("DEVLOG_RETENTION_INTERVAL", "1h"))
+	if err != nil || retentionInterval <= 0 {
+		log.Fatalf("invalid DEVLOG_RETENTION_INTERVAL: %q", os.Getenv("DEVLOG_RETENTION_INTERVAL"))
+	}
+	if retentionDays > 0 {
+		policy := retentionPolicy{days: retentionDays, interval: retentionInterval, dayOpts: defaultDayOpts}
+		go policy.watch(store)
+	}
+
+	defaultTerminalModel, err := loadTerminalModel(
+		envOr("DEVLOG_TERMINAL_MODEL", terminalModelSpan),
+		envOr("DEVLOG_SESSION_GAP", "15m"),
+		envOr("DEVLOG_SESSION_TAIL", "5m"),
+	)
+	if err != nil {
+		log.Fatalf("invalid DEVLOG_TERMINAL_MODEL/DEVLOG_SESSION_GAP/DEVLOG_SESSION_TAIL: %v", err)
+	}
+
+	defaultOverlap, err := parseOverlapMode(envOr("DEVLOG_OVERLAP", overlapBrowser), overlapBrowser)
+	if err != nil {
+		log.Fatalf("invalid DEVLOG_OVERLAP: %v", err)
+	}
+
+	projects := newProjectsManager(projectsPath)
+	projects.watch(projectsPoll)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			query := r.URL.Query()
+			filter, err := parsePurgeFilter(query, defaultDayOpts)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			dryRun, err := parseDryRun(query)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			result, err := store.purge(filter, dryRun)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to purge events"})
+				return
+			}
+			if result.PurgeID > 0 {
+				log.Printf("purge %d: deleted %d events and trimmed %d rollups", result.PurgeID, result.Events, result.Rollups)
+			}
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
 		if r.Method != http.MethodPost {
-			w.Header().Set("Allow", http.MethodPost)
+			w.Header().Set("Allow", http.MethodPost+", "+http.MethodDelete)
 			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 			return
 		}
+		privacy, ok := projects.privacy()
+		if !ok {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "projects config not loaded"})
+			return
+		}
 		defer r.Body.Close()
 		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 		if err != nil {
@@ -824,16 +1032,32 @@ func main() {
 			return
 		}
 
-		ev, err := normalizeEvent(body)
+		ev, payload, err := privacy.prepare(body)
+		if errors.Is(err, errIgnoredEvent) {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ignored", "event_id": ev.EventID})
+			return
+		}
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
 
-		payload := string(body)
-		if err := store.insert(ev, payload); err != nil {
-			if err.Error() == "event_id already exists" {
-				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		if err := store.insert(ev, string(payload)); err != nil {
+			if errors.Is(err, errDuplicateEvent) {
+				conflicts, err := duplicateConflicts(store.db, ev)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to persist event"})
+					return
+				}
+				if len(conflicts) > 0 {
+					writeJSON(w, http.StatusConflict, map[string]any{
+						"error":     "event_id already exists with a different payload",
+						"event_id":  ev.EventID,
+						"conflicts": conflicts,
+					})
+					return
+				}
+				writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate", "event_id": ev.EventID})
 				return
 			}
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to persist event"})
@@ -843,113 +1067,139 @@ func main() {
 		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "event_id": ev.EventID})
 	})
 
-	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.Header().Set("Allow", http.MethodGet)
+	mux.HandleFunc("/events:batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
 			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 			return
 		}
-
-		date := r.URL.Query().Get("date")
-		if date == "" {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "date is required (YYYY-MM-DD, local time)"})
+		privacy, ok := projects.privacy()
+		if !ok {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "projects config not loaded"})
 			return
 		}
-		if _, err := time.Parse("2006-01-02", date); err != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "date must be YYYY-MM-DD (local time)"})
+		defer r.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBatchBodyBytes+1))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+			return
+		}
+		if len(body) > maxBatchBodyBytes {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "body too large"})
 			return
 		}
 
-		projectName := r.URL.Query().Get("project")
-
-		terminal, err := store.terminalDurationsByCWD(date)
+		items, err := splitBatchBody(body)
 		if err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to compute terminal stats"})
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
-		browser, err := store.browserDurationsByTitle(date)
+		results, err := store.insertBatch(batchItems(items), privacy)
 		if err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to compute browser stats"})
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to persist events"})
 			return
 		}
 
-		cfg, err := loadProjectsConfig(projectsPath)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load projects config"})
+		writeJSON(w, http.StatusOK, map[string]any{
+			"results": results,
+			"counts":  countBatchResults(results),
+		})
+	})
+
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 			return
 		}
-		if errors.Is(err, os.ErrNotExist) {
-			cfg = ProjectsConfig{}
+		filter, err := parseExportFilter(r.URL.Query(), defaultDayOpts)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
 		}
 
-		if projectName != "" {
-			rows, totalSeconds, projectExists, err := drillDownRows(terminal, browser, cfg, projectName)
-			if err != nil {
-				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid projects config"})
-				return
-			}
-			if !projectExists || len(rows) == 0 {
-				writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
-				return
-			}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if _, err := store.exportEvents(w, filter); err != nil {
+			log.Printf("export failed: %v", err)
+		}
+	})
 
-			sort.Slice(rows, func(i, j int) bool {
-				if rows[i].seconds != rows[j].seconds {
-					return rows[i].seconds > rows[j].seconds
-				}
-				if rows[i].name != rows[j].name {
-					return rows[i].name < rows[j].name
-				}
-				return rows[i].typ < rows[j].typ
-			})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
 
-			mode := r.URL.Query().Get("mode")
-			if mode == "" || mode == "md" {
-				body := renderDrillDownMarkdown(projectName, totalSeconds, rows)
-				writeMarkdown(w, http.StatusOK, body)
-				return
-			}
-			if mode != "json" {
-				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mode must be 'json' or 'md'"})
+		days, isRange, err := parseStatsDays(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		dayOpts, err := parseDayOptions(r.URL.Query(), defaultDayOpts)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		windows := dayOpts.windows(days)
+		model, err := parseTerminalModel(r.URL.Query(), defaultTerminalModel)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		overlap, err := parseOverlapMode(r.URL.Query().Get("overlap"), defaultOverlap)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		snap := projects.snapshot()
+		if snap == nil {
+			loadErr, _ := projects.loadError()
+			var cfgErr *configError
+			if errors.As(loadErr, &cfgErr) {
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid projects config", "problems": cfgErr.problems})
 				return
 			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load projects config"})
+			return
+		}
 
-			type drillDownItem struct {
-				TitleCWD   string `json:"title/cwd"`
-				Type       string `json:"type"`
-				MinStartTS string `json:"min_start_ts"`
-				MaxEndTS   string `json:"max_end_ts"`
-				Seconds    int64  `json:"seconds"`
-			}
+		if isRange {
+			serveRangeStats(w, r, store, snap, windows, model, overlap)
+			return
+		}
 
-			list := make([]drillDownItem, 0, len(rows))
-			for _, row := range rows {
-				list = append(list, drillDownItem{
-					TitleCWD:   row.name,
-					Type:       row.typ,
-					MinStartTS: row.minTS,
-					MaxEndTS:   row.maxTS,
-					Seconds:    row.seconds,
-				})
-			}
+		window := windows[0]
+		model = model.within(window)
+		projectName := r.URL.Query().Get("project")
 
-			writeJSON(w, http.StatusOK, map[string]any{
-				"name":    projectName,
-				"seconds": totalSeconds,
-				"list":    list,
-			})
+		terminal, err := store.terminalDurationsByCommand(window)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to compute terminal stats"})
 			return
 		}
-
-		projectsTotals, project_others, err := classifyProjects(terminal, browser, cfg)
+		browser, err := store.browserDurationsByTitle(window)
 		if err != nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid projects config"})
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to compute browser stats"})
 			return
 		}
 
+		if projectName != "" {
+			rows, totalSeconds, projectExists := drillDownRows(terminal, browser, snap, model, overlap, projectName)
+			if !projectExists || len(rows) == 0 {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+				return
+			}
+			writeDrillDown(w, r, projectName, totalSeconds, rows)
+			return
+		}
+
+		projectsTotals, project_others, tracked := classifyProjects(terminal, browser, snap, model, overlap)
+
 		mode := r.URL.Query().Get("mode")
 		if mode == "" || mode == "md" {
-			body := renderStatsMarkdown(projectsTotals, project_others)
+			body := renderStatsMarkdown(projectsTotals, project_others, tracked)
 			writeMarkdown(w, http.StatusOK, body)
 			return
 		}
@@ -958,11 +1208,87 @@ func main() {
 			return
 		}
 
-		writeJSON(w, http.StatusOK, map[string]any{
-			"terminal_command":    spansToSeconds(terminal),
-			"browser_active_span": browser,
+		result := map[string]any{
+			"terminal_command":    spansToSeconds(terminalSpansByCWD(terminal), model),
+			"browser_active_span": browserSecondsByTitle(browser),
 			"projects":            projectsTotals,
-			"project_others":      project_others,
+			"tracked_seconds":     tracked.tracked,
+			"source_seconds":      tracked.sources(),
+		}
+		if project_others != nil {
+			result["project_others"] = project_others
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+
+	mux.HandleFunc("/projects/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, projects.status())
+	})
+
+	mux.HandleFunc("/projects/explain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		query := r.URL.Query()
+		title := query.Get("title")
+		url := query.Get("url")
+		cwd := query.Get("cwd")
+		command := query.Get("command")
+		if title == "" && url == "" && cwd == "" && command == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "one of title, url, cwd or command is required"})
+			return
+		}
+		snap := projects.snapshot()
+		if snap == nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load projects config"})
+			return
+		}
+		result := explainInput(snap, title, url, cwd, command)
+		result["version"] = snap.version
+		writeJSON(w, http.StatusOK, result)
+	})
+
+	mux.HandleFunc("/projects/validate", func(w http.ResponseWriter, r *http.Request) {
+		var data []byte
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			data, err = os.ReadFile(projectsPath)
+			if errors.Is(err, os.ErrNotExist) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "projects config not found"})
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load projects config"})
+				return
+			}
+		case http.MethodPost:
+			defer r.Body.Close()
+			data, err = io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+				return
+			}
+		default:
+			w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		_, problems := validateProjectsConfig(data)
+		if problems == nil {
+			problems = []configProblem{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"valid":    len(problems) == 0,
+			"problems": problems,
 		})
 	})
 
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"devlog-report/internal/events"
+)
+
+const (
+	fixtureDays         = 365
+	fixtureBrowserSpans = 60
+	fixtureCommands     = 80
+	fixtureQueryDate    = "2025-07-01"
+	fixtureQueryMonth   = "2025-06"
+	dayStatsCeiling     = 50 * time.Millisecond
+	monthStatsCeiling   = time.Second
+)
+
+var fixtureFirstDay = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newFixtureStore(tb testing.TB) *eventStore {
+	tb.Helper()
+	store, err := newEventStore(filepath.Join(tb.TempDir(), "devlog.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = store.close() })
+	if _, err := migrateUp(store.db); err != nil {
+		tb.Fatal(err)
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer tx.Rollback()
+	receivedAt := time.Now()
+	insert := func(ev events.Event) {
+		if err := insertEvent(tx, ev, "{}", receivedAt); err != nil {
+			tb.Fatalf("insert %s: %v", ev.EventID, err)
+		}
+	}
+
+	for day := 0; day < fixtureDays; day++ {
+		base := fixtureFirstDay.AddDate(0, 0, day).Add(9 * time.Hour)
+		for i := 0; i < fixtureBrowserSpans; i++ {
+			start := base.Add(time.Duration(i) * 5 * time.Minute)
+			insert(events.Event{
+				EventID:       fmt.Sprintf("b-%d-%d", day, i),
+				Type:          "browser_active_span",
+				Source:        "chrome",
+				SchemaVersion: 2,
+				StartTS:       start.Format(time.RFC3339),
+				EndTS:         start.Add(3 * time.Minute).Format(time.RFC3339),
+				URL:           fmt.Sprintf("https://github.com/our-org/repo/pull/%d", i%12),
+				Title:         fmt.Sprintf("Pull request #%d", i%12),
+			})
+		}
+		for i := 0; i < fixtureCommands; i++ {
+			start := base.Add(time.Duration(i) * 4 * time.Minute)
+			insert(events.Event{
+				EventID:       fmt.Sprintf("t-%d-%d", day, i),
+				Type:          "terminal_command",
+				Source:        "zsh",
+				SchemaVersion: 2,
+				StartTS:       start.Format(time.RFC3339),
+				EndTS:         start.Add(2 * time.Second).Format(time.RFC3339),
+				CWD:           fmt.Sprintf("/home/me/dev/app%d", i%5),
+				Command:       fmt.Sprintf("make test-%d", i%7),
+			})
+		}
+	}
+
+	// A tab left open for a month pushes the lower bound of
+	// windowOverlapCondition a month back from the queried day.
+	insert(events.Event{
+		EventID:       "b-long",
+		Type:          "browser_active_span",
+		Source:        "chrome",
+		SchemaVersion: 2,
+		StartTS:       "2025-06-01T00:00:00Z",
+		EndTS:         "2025-07-01T12:00:00Z",
+		URL:           "https://example.com/dashboard",
+		Title:         "Forgotten dashboard",
+	})
+	// The same for terminal commands: a single long-running job.
+	insert(events.Event{
+		EventID:       "t-long",
+		Type:          "terminal_command",
+		Source:        "zsh",
+		SchemaVersion: 2,
+		StartTS:       "2025-06-15T00:00:00Z",
+		EndTS:         "2025-07-01T06:00:00Z",
+		CWD:           "/home/me/jobs",
+		Command:       "./backfill.sh",
+	})
+
+	if err := tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+	return store
+}
+
+func fixtureWindow(tb testing.TB) dayWindow {
+	tb.Helper()
+	opts, err := loadDayOptions("UTC", "00:00")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return opts.window(fixtureQueryDate)
+}
+
+func fixtureProjects(tb testing.TB) *projectsSnapshot {
+	tb.Helper()
+	cfg := ProjectsConfig{Projects: []ProjectConfig{
+		{Name: "app", Match: ProjectMatch{
+			Browser:  BrowserMatch{URL: []string{`github\.com/our-org/repo/pull/[0-5]$`}},
+			Terminal: TerminalMatch{CWD: []string{"^/home/me/dev/app[0-2]$"}},
+		}},
+		{Name: "jobs", Match: ProjectMatch{
+			Terminal: TerminalMatch{CWD: []string{"^/home/me/jobs$"}},
+		}},
+	}}
+	compiled, err := compileProjectMatchers(cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &projectsSnapshot{cfg: cfg, compiled: compiled, privacy: defaultPrivacyPolicy}
+}
+
+func fixtureMonth(tb testing.TB) []dayWindow {
+	tb.Helper()
+	opts, err := loadDayOptions("UTC", "00:00")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	first, err := time.Parse("2006-01", fixtureQueryMonth)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var days []string
+	for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(dateLayout))
+	}
+	return opts.windows(days)
+}
+
+func fixtureModel(tb testing.TB, kind string) terminalModel {
+	tb.Helper()
+	model, err := loadTerminalModel(kind, "15m", "5m")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return model
+}
+
+func dayStatsMarkdown(store *eventStore, projects *projectsSnapshot, window dayWindow, model terminalModel, overlap string) (string, error) {
+	model = model.within(window)
+	terminal, err := store.terminalDurationsByCommand(window)
+	if err != nil {
+		return "", err
+	}
+	browser, err := store.browserDurationsByTitle(window)
+	if err != nil {
+		return "", err
+	}
+	totals, others, tracked := classifyProjects(terminal, browser, projects, model, overlap)
+	return renderStatsMarkdown(totals, others, tracked), nil
+}
+
+func monthStatsMarkdown(store *eventStore, projects *projectsSnapshot, windows []dayWindow, model terminalModel, overlap string) (string, error) {
+	stats, err := computeRangeStats(store, projects, windows, model, overlap)
+	if err != nil {
+		return "", err
+	}
+	return renderRangeStatsMarkdown(stats), nil
+}
+
+func bestOf(tb testing.TB, runs int, fn func() error) time.Duration {
+	tb.Helper()
+	best := time.Duration(-1)
+	for i := 0; i < runs; i++ {
+		started := time.Now()
+		if err := fn(); err != nil {
+			tb.Fatal(err)
+		}
+		if elapsed := time.Since(started); best < 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	return best
+}
+
+func TestDayQueries(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a year of events")
+	}
+	store := newFixtureStore(t)
+	window := fixtureWindow(t)
+
+	t.Run("long spans", func(t *testing.T) {
+		browser, err := store.browserDurationsByTitle(window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		long := browser[browserKey{title: "Forgotten dashboard", url: "https://example.com/dashboard"}]
+		if got := sumIntervalSeconds(long); got != 12*3600 {
+			t.Fatalf("long browser span: got %d seconds, want %d", got, 12*3600)
+		}
+		if got := len(browser); got != 13 {
+			t.Fatalf("browser keys: got %d, want 13", got)
+		}
+
+		terminal, err := store.terminalDurationsByCommand(window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, ok := terminal[terminalKey{cwd: "/home/me/jobs", command: "./backfill.sh"}]
+		if !ok {
+			t.Fatal("long terminal command is missing")
+		}
+		if !job.minStart.Equal(window.start) {
+			t.Fatalf("long terminal command: got start %s, want %s", job.minStart, window.start)
+		}
+		if got := len(terminal); got != 36 {
+			t.Fatalf("terminal keys: got %d, want 36", got)
+		}
+	})
+
+	// Wall-clock ceilings depend on the machine, so they only run on request:
+	// DEVLOG_TEST_LATENCY=1 go test ./cmd/devlogd -run DayQueries
+	t.Run("stats latency", func(t *testing.T) {
+		if os.Getenv("DEVLOG_TEST_LATENCY") == "" {
+			t.Skip("set DEVLOG_TEST_LATENCY=1 to check /stats latency ceilings")
+		}
+		projects := fixtureProjects(t)
+		month := fixtureMonth(t)
+		for _, kind := range []string{terminalModelSpan, terminalModelSession} {
+			model := fixtureModel(t, kind)
+			for _, overlap := range []string{overlapNone, overlapBrowser, overlapTerminal, overlapSplit} {
+				day := bestOf(t, 5, func() error {
+					_, err := dayStatsMarkdown(store, projects, window, model, overlap)
+					return err
+				})
+				if day > dayStatsCeiling {
+					t.Errorf("%s/%s: one day of /stats took %s, want at most %s", kind, overlap, day, dayStatsCeiling)
+				}
+				monthly := bestOf(t, 3, func() error {
+					_, err := monthStatsMarkdown(store, projects, month, model, overlap)
+					return err
+				})
+				if monthly > monthStatsCeiling {
+					t.Errorf("%s/%s: one month of /stats took %s, want at most %s", kind, overlap, monthly, monthStatsCeiling)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkTerminalDurationsByCommand(b *testing.B) {
+	store := newFixtureStore(b)
+	window := fixtureWindow(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.terminalDurationsByCommand(window); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBrowserDurationsByTitle(b *testing.B) {
+	store := newFixtureStore(b)
+	window := fixtureWindow(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.browserDurationsByTitle(window); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDayStats(b *testing.B) {
+	store := newFixtureStore(b)
+	projects := fixtureProjects(b)
+	window := fixtureWindow(b)
+	model := fixtureModel(b, terminalModelSession)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dayStatsMarkdown(store, projects, window, model, overlapSplit); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMonthStats(b *testing.B) {
+	store := newFixtureStore(b)
+	projects := fixtureProjects(b)
+	month := fixtureMonth(b)
+	model := fixtureModel(b, terminalModelSession)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := monthStatsMarkdown(store, projects, month, model, overlapSplit); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func testProjects(tb testing.TB) *projectsSnapshot {
+	tb.Helper()
+	cfg := ProjectsConfig{Projects: []ProjectConfig{
+		{Name: "X", Match: ProjectMatch{
+			Browser:  BrowserMatch{Title: []string{"^X:"}},
+			Terminal: TerminalMatch{CWD: []string{"^/x(/|$)"}},
+		}},
+		{Name: "Y", Match: ProjectMatch{
+			Terminal: TerminalMatch{Command: []string{"^deploy"}},
+		}},
+	}}
+	compiled, err := compileProjectMatchers(cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &projectsSnapshot{cfg: cfg, compiled: compiled, privacy: defaultPrivacyPolicy}
+}
+
+type testDay struct {
+	date     string
+	terminal map[terminalKey]span
+	browser  map[browserKey][]interval
+}
+
+func newTestDay(date string) *testDay {
+	return &testDay{date: date, terminal: make(map[terminalKey]span), browser: make(map[browserKey][]interval)}
+}
+
+func (d *testDay) at(clock string) time.Time {
+	t, err := time.Parse(time.RFC3339, d.date+"T"+clock+":00Z")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (d *testDay) command(clock, cwd, command string) *testDay {
+	at := d.at(clock)
+	updateSpanAgg(d.terminal, terminalKey{cwd: cwd, command: command}, span{
+		minStart:  at,
+		maxEnd:    at,
+		intervals: []interval{{start: at, end: at}},
+	})
+	return d
+}
+
+func (d *testDay) tab(from, to, title string) *testDay {
+	key := browserKey{title: title, url: "https://example.com/" + title}
+	d.browser[key] = append(d.browser[key], interval{start: d.at(from), end: d.at(to)})
+	return d
+}
+
+func TestDrillDownTotalsMatchStats(t *testing.T) {
+	projects := testProjects(t)
+	opts, err := loadDayOptions("UTC", "00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := "2026-01-05"
+	days := map[string]*testDay{
+		"project span across cwds": newTestDay(date).
+			command("09:00", "/x/a", "make").
+			command("17:00", "/x/b", "make"),
+		"unrelated other commands": newTestDay(date).
+			command("09:00", "/tmp", "ls").
+			command("10:00", "/x", "make").
+			command("11:00", "/x", "make test").
+			command("18:00", "/home", "ls"),
+		"browser and terminal overlap": newTestDay(date).
+			command("09:50", "/x/a", "make").
+			command("10:50", "/x/b", "make").
+			command("10:10", "/tmp", "ls").
+			command("10:35", "/tmp", "ls").
+			command("10:20", "/srv", "deploy prod").
+			command("11:30", "/srv", "deploy prod").
+			tab("10:00", "10:30", "X: issue").
+			tab("10:15", "10:45", "X: review").
+			tab("10:20", "10:40", "News").
+			tab("11:00", "11:20", "News"),
+	}
+	want := map[string]map[string]int64{
+		"project span across cwds": {"X": 8 * 3600},
+		"unrelated other commands": {"X": 3600},
+	}
+
+	for name, day := range days {
+		window := opts.window(day.date)
+		for _, kind := range []string{terminalModelSpan, terminalModelSession} {
+			model, err := loadTerminalModel(kind, "15m", "5m")
+			if err != nil {
+				t.Fatal(err)
+			}
+			model = model.within(window)
+			for _, overlap := range []string{overlapNone, overlapBrowser, overlapTerminal, overlapSplit} {
+				totals, _, _ := classifyProjects(day.terminal, day.browser, projects, model, overlap)
+				for project, seconds := range totals {
+					rows, total, ok := drillDownRows(day.terminal, day.browser, projects, model, overlap, project)
+					if !ok {
+						t.Fatalf("%s/%s/%s: project %s not found", name, kind, overlap, project)
+					}
+					if total != seconds {
+						t.Errorf("%s/%s/%s: %s drill-down total %d, /stats total %d", name, kind, overlap, project, total, seconds)
+					}
+					if overlap == overlapNone || len(rows) == 0 {
+						continue
+					}
+					var sum int64
+					for _, row := range rows {
+						sum += row.seconds
+					}
+					if sum != total {
+						t.Errorf("%s/%s/%s: %s rows add up to %d, total %d", name, kind, overlap, project, sum, total)
+					}
+				}
+				if kind != terminalModelSpan {
+					continue
+				}
+				for project, seconds := range want[name] {
+					if totals[project] != seconds {
+						t.Errorf("%s/%s/%s: %s got %d seconds, want %d", name, kind, overlap, project, totals[project], seconds)
+					}
+				}
+			}
+		}
+	}
+}
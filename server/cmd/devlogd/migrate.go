@@ -0,0 +1,406 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"devlog-report/internal/events"
+)
+
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+	down    func(tx *sql.Tx) error
+}
+
+type migrationStatus struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt string `json:"applied_at,omitempty"`
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create_events",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id TEXT NOT NULL UNIQUE,
+	type TEXT NOT NULL,
+	source TEXT NOT NULL,
+	schema_version INTEGER NOT NULL,
+	start_ts TEXT NOT NULL,
+	end_ts TEXT NOT NULL,
+	url TEXT,
+	title TEXT,
+	cwd TEXT,
+	command TEXT,
+	payload TEXT NOT NULL,
+	received_at TEXT NOT NULL
+);
+`)
+			return err
+		},
+		down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE IF EXISTS events`)
+			return err
+		},
+	},
+	{
+		version: 2,
+		name:    "terminal_end_ts_schema_v2",
+		up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`
+UPDATE events
+SET end_ts = start_ts
+WHERE schema_version = 1 AND type = 'terminal_command'
+`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`
+UPDATE events
+SET schema_version = 2
+WHERE schema_version = 1
+`)
+			return err
+		},
+	},
+	{
+		version: 3,
+		name:    "terminal_exit_code_duration",
+		up: func(tx *sql.Tx) error {
+			columns, err := tableColumns(tx, "events")
+			if err != nil {
+				return err
+			}
+			if !columns["exit_code"] {
+				if _, err := tx.Exec(`ALTER TABLE events ADD COLUMN exit_code INTEGER`); err != nil {
+					return err
+				}
+			}
+			if !columns["duration_ms"] {
+				if _, err := tx.Exec(`ALTER TABLE events ADD COLUMN duration_ms INTEGER`); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`ALTER TABLE events DROP COLUMN duration_ms`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`ALTER TABLE events DROP COLUMN exit_code`)
+			return err
+		},
+	},
+	{
+		version: 4,
+		name:    "event_epoch_columns",
+		up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`ALTER TABLE events ADD COLUMN start_ms INTEGER`); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`ALTER TABLE events ADD COLUMN end_ms INTEGER`); err != nil {
+				return err
+			}
+			if err := backfillEpochColumns(tx); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`CREATE INDEX idx_events_type_start ON events (type, start_ms)`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`CREATE INDEX idx_events_type_length ON events (type, end_ms - start_ms)`)
+			return err
+		},
+		down: func(tx *sql.Tx) error {
+			for _, stmt := range []string{
+				`DROP INDEX IF EXISTS idx_events_type_length`,
+				`DROP INDEX IF EXISTS idx_events_type_start`,
+				`ALTER TABLE events DROP COLUMN end_ms`,
+				`ALTER TABLE events DROP COLUMN start_ms`,
+			} {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 5,
+		name:    "create_daily_rollups",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE daily_rollups (
+	day TEXT NOT NULL,
+	window_start_ms INTEGER NOT NULL,
+	window_end_ms INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	url TEXT NOT NULL DEFAULT '',
+	cwd TEXT NOT NULL DEFAULT '',
+	command TEXT NOT NULL DEFAULT '',
+	min_start_ms INTEGER NOT NULL,
+	max_end_ms INTEGER NOT NULL,
+	seconds INTEGER NOT NULL,
+	intervals TEXT NOT NULL,
+	UNIQUE (type, window_start_ms, title, url, cwd, command)
+);
+CREATE TABLE compacted_events (
+	event_id TEXT PRIMARY KEY
+) WITHOUT ROWID;
+`)
+			return err
+		},
+		down: func(tx *sql.Tx) error {
+			var exists int
+			err := tx.QueryRow(`SELECT 1 FROM daily_rollups LIMIT 1`).Scan(&exists)
+			if err == nil {
+				return errors.New("daily_rollups is not empty; reverting would drop compacted history")
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if _, err := tx.Exec(`DROP TABLE compacted_events`); err != nil {
+				return err
+			}
+			_, err = tx.Exec(`DROP TABLE daily_rollups`)
+			return err
+		},
+	},
+	{
+		version: 6,
+		name:    "create_purges",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+CREATE TABLE purges (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	purged_at TEXT NOT NULL,
+	from_ms INTEGER NOT NULL,
+	to_ms INTEGER NOT NULL,
+	type TEXT NOT NULL DEFAULT '',
+	match TEXT NOT NULL DEFAULT '',
+	events INTEGER NOT NULL,
+	rollups INTEGER NOT NULL,
+	event_ids TEXT NOT NULL
+);
+`)
+			return err
+		},
+		down: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DROP TABLE purges`)
+			return err
+		},
+	},
+}
+
+func latestMigration() int {
+	return migrations[len(migrations)-1].version
+}
+
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+func backfillEpochColumns(tx *sql.Tx) error {
+	type epochRow struct {
+		id      int64
+		startMS int64
+		endMS   int64
+	}
+	rows, err := tx.Query(`SELECT id, start_ts, end_ts FROM events`)
+	if err != nil {
+		return err
+	}
+	var values []epochRow
+	for rows.Next() {
+		var id int64
+		var startStr string
+		var endStr string
+		if err := rows.Scan(&id, &startStr, &endStr); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		startTime, err := events.ParseTime(startStr)
+		if err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("event %d: start_ts: %w", id, err)
+		}
+		endTime, err := events.ParseTime(endStr)
+		if err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("event %d: end_ts: %w", id, err)
+		}
+		values = append(values, epochRow{id: id, startMS: startTime.UnixMilli(), endMS: endTime.UnixMilli()})
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`UPDATE events SET start_ms = ?, end_ms = ? WHERE id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, value := range values {
+		if _, err := stmt.Exec(value.startMS, value.endMS, value.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TEXT NOT NULL
+);
+`)
+	return err
+}
+
+func appliedMigrations(db *sql.DB) (map[int]string, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func migrationStatuses(db *sql.DB) ([]migrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]migrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.version]
+		out = append(out, migrationStatus{Version: m.version, Name: m.name, Applied: ok, AppliedAt: appliedAt})
+	}
+	for version, appliedAt := range applied {
+		if version > latestMigration() {
+			out = append(out, migrationStatus{Version: version, Name: "unknown", Applied: true, AppliedAt: appliedAt})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Version < out[j].Version
+	})
+	return out, nil
+}
+
+func migrateUp(db *sql.DB) ([]migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	for version := range applied {
+		if version > latestMigration() {
+			return nil, fmt.Errorf("database has migration %d applied, but this binary only knows up to %d", version, latestMigration())
+		}
+	}
+
+	var done []migration
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		err := runMigration(db, m.up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.version, m.name, time.Now().UTC().Format(time.RFC3339Nano),
+			)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func migrateDownTo(db *sql.DB, target int) ([]migration, error) {
+	if target < 0 || target > latestMigration() {
+		return nil, fmt.Errorf("target must be between 0 and %d", latestMigration())
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version <= target {
+			break
+		}
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+		if m.down == nil {
+			return done, fmt.Errorf("migration %d (%s) cannot be reverted", m.version, m.name)
+		}
+		err := runMigration(db, m.down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func runMigration(db *sql.DB, steps ...func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if err := step(tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
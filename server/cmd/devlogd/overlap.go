@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	overlapNone     = "none"
+	overlapBrowser  = "browser"
+	overlapTerminal = "terminal"
+	overlapSplit    = "split"
+
+	sourceBrowser  = "browser"
+	sourceTerminal = "terminal"
+)
+
+func parseOverlapMode(value string, fallback string) (string, error) {
+	if value == "" {
+		value = fallback
+	}
+	switch value {
+	case "":
+		return overlapNone, nil
+	case overlapNone, overlapBrowser, overlapTerminal, overlapSplit:
+		return value, nil
+	default:
+		return "", errors.New("overlap must be 'none', 'browser', 'terminal' or 'split'")
+	}
+}
+
+type claim struct {
+	project string
+	source  string
+	interval
+}
+
+type trackedTime struct {
+	tracked  int64
+	browser  int64
+	terminal int64
+}
+
+func (t *trackedTime) add(other trackedTime) {
+	t.tracked += other.tracked
+	t.browser += other.browser
+	t.terminal += other.terminal
+}
+
+func (t trackedTime) sources() map[string]int64 {
+	return map[string]int64{
+		sourceBrowser:  t.browser,
+		sourceTerminal: t.terminal,
+	}
+}
+
+func resolveTimeline(claims []claim, mode string) (map[string]int64, int64) {
+	type boundary struct {
+		at    time.Time
+		delta int
+		key   claimKey
+	}
+	var boundaries []boundary
+	for _, c := range claims {
+		if !c.end.After(c.start) {
+			continue
+		}
+		key := claimKey{project: c.project, source: c.source}
+		boundaries = append(boundaries,
+			boundary{at: c.start, delta: 1, key: key},
+			boundary{at: c.end, delta: -1, key: key},
+		)
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].at.Before(boundaries[j].at)
+	})
+
+	active := make(map[claimKey]int)
+	shares := make(map[string]float64)
+	var tracked time.Duration
+	for i := 0; i < len(boundaries); {
+		at := boundaries[i].at
+		for ; i < len(boundaries) && boundaries[i].at.Equal(at); i++ {
+			active[boundaries[i].key] += boundaries[i].delta
+			if active[boundaries[i].key] == 0 {
+				delete(active, boundaries[i].key)
+			}
+		}
+		if i == len(boundaries) || len(active) == 0 {
+			continue
+		}
+		segment := boundaries[i].at.Sub(at)
+		tracked += segment
+
+		winners := overlapWinners(active, mode)
+		for _, key := range winners {
+			shares[key.project] += segment.Seconds() / float64(len(winners))
+		}
+	}
+
+	out := make(map[string]int64, len(shares))
+	for project, seconds := range shares {
+		out[project] = int64(math.Floor(seconds))
+	}
+	return out, int64(tracked.Seconds())
+}
+
+type claimKey struct {
+	project string
+	source  string
+}
+
+func overlapWinners(active map[claimKey]int, mode string) []claimKey {
+	bySource := map[string][]claimKey{}
+	var all []claimKey
+	for key := range active {
+		bySource[key.source] = append(bySource[key.source], key)
+		all = append(all, key)
+	}
+	switch mode {
+	case overlapBrowser:
+		if len(bySource[sourceBrowser]) > 0 {
+			return bySource[sourceBrowser]
+		}
+		return bySource[sourceTerminal]
+	case overlapTerminal:
+		if len(bySource[sourceTerminal]) > 0 {
+			return bySource[sourceTerminal]
+		}
+		return bySource[sourceBrowser]
+	default:
+		return all
+	}
+}
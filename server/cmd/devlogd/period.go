@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout         = "2006-01-02"
+	maxStatsRangeDays  = 366
+	markdownDayWidth   = 5
+	markdownDayLayout  = "01-02"
+	statsRangeErrorMsg = "failed to compute stats"
+)
+
+func parseStatsDays(query url.Values) ([]string, bool, error) {
+	date := query.Get("date")
+	from := query.Get("from")
+	to := query.Get("to")
+	period := query.Get("period")
+
+	var start, end time.Time
+	switch {
+	case from != "" || to != "":
+		if from == "" || to == "" {
+			return nil, false, errors.New("from and to must be given together")
+		}
+		if period != "" || date != "" {
+			return nil, false, errors.New("from/to cannot be combined with date or period")
+		}
+		var err error
+		if start, err = time.Parse(dateLayout, from); err != nil {
+			return nil, false, errors.New("from must be YYYY-MM-DD")
+		}
+		if end, err = time.Parse(dateLayout, to); err != nil {
+			return nil, false, errors.New("to must be YYYY-MM-DD")
+		}
+		if end.Before(start) {
+			return nil, false, errors.New("to must not be before from")
+		}
+	default:
+		if date == "" {
+			return nil, false, errors.New("date is required (YYYY-MM-DD)")
+		}
+		anchor, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return nil, false, errors.New("date must be YYYY-MM-DD")
+		}
+		switch period {
+		case "", "day":
+			return []string{date}, false, nil
+		case "week":
+			offset := (int(anchor.Weekday()) + 6) % 7
+			start = anchor.AddDate(0, 0, -offset)
+			end = start.AddDate(0, 0, 6)
+		case "month":
+			start = time.Date(anchor.Year(), anchor.Month(), 1, 0, 0, 0, 0, time.UTC)
+			end = start.AddDate(0, 1, -1)
+		default:
+			return nil, false, errors.New("period must be 'day', 'week' or 'month'")
+		}
+	}
+
+	var days []string
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		days = append(days, d.Format(dateLayout))
+		if len(days) > maxStatsRangeDays {
+			return nil, false, errors.New("range must not exceed " + strconv.Itoa(maxStatsRangeDays) + " days")
+		}
+	}
+	return days, true, nil
+}
+
+type dayOptions struct {
+	loc      *time.Location
+	dayStart time.Duration
+}
+
+type dayWindow struct {
+	date  string
+	start time.Time
+	end   time.Time
+}
+
+const windowOverlapCondition = `type = ?
+	AND start_ms < ?
+	AND start_ms >= ? - (SELECT ifnull(max(end_ms - start_ms), 0) FROM events WHERE type = ?)
+	AND (end_ms > ? OR start_ms >= ?)`
+
+func (w dayWindow) overlapParams(eventType string) []any {
+	start := w.start.UnixMilli()
+	end := w.end.UnixMilli()
+	return []any{eventType, end, start, eventType, start, start}
+}
+
+func (w dayWindow) clip(start, end time.Time) (time.Time, time.Time) {
+	if start.Before(w.start) {
+		start = w.start
+	}
+	if end.After(w.end) {
+		end = w.end
+	}
+	if end.Before(start) {
+		end = start
+	}
+	return start, end
+}
+
+func loadDayOptions(tz string, dayStart string) (dayOptions, error) {
+	opts := dayOptions{loc: time.Local}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return dayOptions{}, errors.New("unknown tz: " + tz)
+		}
+		opts.loc = loc
+	}
+	offset, err := parseDayStart(dayStart)
+	if err != nil {
+		return dayOptions{}, err
+	}
+	opts.dayStart = offset
+	return opts, nil
+}
+
+func parseDayOptions(query url.Values, defaults dayOptions) (dayOptions, error) {
+	opts := defaults
+	if tz := query.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return dayOptions{}, errors.New("unknown tz: " + tz)
+		}
+		opts.loc = loc
+	}
+	if value := query.Get("day_start"); value != "" {
+		offset, err := parseDayStart(value)
+		if err != nil {
+			return dayOptions{}, err
+		}
+		opts.dayStart = offset
+	}
+	return opts, nil
+}
+
+func parseDayStart(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.New("day_start must be HH:MM")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (o dayOptions) window(date string) dayWindow {
+	day, _ := time.Parse(dateLayout, date)
+	hour := int(o.dayStart / time.Hour)
+	minute := int(o.dayStart % time.Hour / time.Minute)
+	return dayWindow{
+		date:  date,
+		start: time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, o.loc),
+		end:   time.Date(day.Year(), day.Month(), day.Day()+1, hour, minute, 0, 0, o.loc),
+	}
+}
+
+func (o dayOptions) windowAt(t time.Time) dayWindow {
+	w := o.window(t.In(o.loc).Format(dateLayout))
+	if t.Before(w.start) {
+		w = o.window(w.start.AddDate(0, 0, -1).Format(dateLayout))
+	}
+	return w
+}
+
+func (w dayWindow) next(opts dayOptions) dayWindow {
+	day, _ := time.Parse(dateLayout, w.date)
+	return opts.window(day.AddDate(0, 0, 1).Format(dateLayout))
+}
+
+func (o dayOptions) windows(days []string) []dayWindow {
+	out := make([]dayWindow, 0, len(days))
+	for _, date := range days {
+		out = append(out, o.window(date))
+	}
+	return out
+}
+
+type dayProjects struct {
+	date     string
+	projects map[string]int64
+}
+
+type rangeStats struct {
+	days          []dayProjects
+	tracked       trackedTime
+	projects      map[string]int64
+	projectOthers map[string]map[string]int64
+	terminal      map[string]int64
+	browser       map[string]int64
+}
+
+func computeRangeStats(
+	store *eventStore,
+	projects *projectsSnapshot,
+	windows []dayWindow,
+	model terminalModel,
+	overlap string,
+) (rangeStats, error) {
+	out := rangeStats{
+		projects: make(map[string]int64),
+		terminal: make(map[string]int64),
+		browser:  make(map[string]int64),
+	}
+	if projects.cfg.Output.includeOther() {
+		out.projectOthers = map[string]map[string]int64{
+			"browser":  {},
+			"terminal": {},
+		}
+	}
+
+	for _, window := range windows {
+		terminal, err := store.terminalDurationsByCommand(window)
+		if err != nil {
+			return rangeStats{}, err
+		}
+		browser, err := store.browserDurationsByTitle(window)
+		if err != nil {
+			return rangeStats{}, err
+		}
+
+		dayModel := model.within(window)
+		totals, others, tracked := classifyProjects(terminal, browser, projects, dayModel, overlap)
+		out.tracked.add(tracked)
+		out.days = append(out.days, dayProjects{date: window.date, projects: totals})
+		for name, seconds := range totals {
+			out.projects[name] += seconds
+		}
+		for typ, items := range others {
+			for name, seconds := range items {
+				out.projectOthers[typ][name] += seconds
+			}
+		}
+		for cwd, seconds := range spansToSeconds(terminalSpansByCWD(terminal), dayModel) {
+			out.terminal[cwd] += seconds
+		}
+		for title, seconds := range browserSecondsByTitle(browser) {
+			out.browser[title] += seconds
+		}
+	}
+	return out, nil
+}
+
+func rangeDrillDownRows(
+	store *eventStore,
+	projects *projectsSnapshot,
+	windows []dayWindow,
+	model terminalModel,
+	overlap string,
+	projectName string,
+) ([]drillDownRow, int64, bool, error) {
+	type rowKey struct {
+		name string
+		typ  string
+	}
+	merged := make(map[rowKey]drillDownRow)
+	var total int64
+	for _, window := range windows {
+		terminal, err := store.terminalDurationsByCommand(window)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		browser, err := store.browserDurationsByTitle(window)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		rows, seconds, exists := drillDownRows(terminal, browser, projects, model.within(window), overlap, projectName)
+		if !exists {
+			return nil, 0, false, nil
+		}
+		total += seconds
+		for _, row := range rows {
+			key := rowKey{name: row.name, typ: row.typ}
+			current, ok := merged[key]
+			if !ok {
+				merged[key] = row
+				continue
+			}
+			current.seconds += row.seconds
+			if row.minTS != "" && (current.minTS == "" || row.minTS < current.minTS) {
+				current.minTS = row.minTS
+			}
+			if row.maxTS > current.maxTS {
+				current.maxTS = row.maxTS
+			}
+			merged[key] = current
+		}
+	}
+
+	rows := make([]drillDownRow, 0, len(merged))
+	for _, row := range merged {
+		rows = append(rows, row)
+	}
+	return rows, total, true, nil
+}
+
+func serveRangeStats(
+	w http.ResponseWriter,
+	r *http.Request,
+	store *eventStore,
+	projects *projectsSnapshot,
+	windows []dayWindow,
+	model terminalModel,
+	overlap string,
+) {
+	if projectName := r.URL.Query().Get("project"); projectName != "" {
+		rows, totalSeconds, projectExists, err := rangeDrillDownRows(store, projects, windows, model, overlap, projectName)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": statsRangeErrorMsg})
+			return
+		}
+		if !projectExists || len(rows) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		writeDrillDown(w, r, projectName, totalSeconds, rows)
+		return
+	}
+
+	stats, err := computeRangeStats(store, projects, windows, model, overlap)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": statsRangeErrorMsg})
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" || mode == "md" {
+		writeMarkdown(w, http.StatusOK, renderRangeStatsMarkdown(stats))
+		return
+	}
+	if mode != "json" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mode must be 'json' or 'md'"})
+		return
+	}
+
+	type dayItem struct {
+		Date     string           `json:"date"`
+		Projects map[string]int64 `json:"projects"`
+	}
+	dayList := make([]dayItem, 0, len(stats.days))
+	for _, day := range stats.days {
+		dayList = append(dayList, dayItem{Date: day.date, Projects: day.projects})
+	}
+
+	result := map[string]any{
+		"from":                windows[0].date,
+		"to":                  windows[len(windows)-1].date,
+		"days":                dayList,
+		"terminal_command":    stats.terminal,
+		"browser_active_span": stats.browser,
+		"projects":            stats.projects,
+		"tracked_seconds":     stats.tracked.tracked,
+		"source_seconds":      stats.tracked.sources(),
+	}
+	if stats.projectOthers != nil {
+		result["project_others"] = stats.projectOthers
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func renderRangeStatsMarkdown(stats rangeStats) string {
+	projectRows := make([]projectRow, 0, len(stats.projects))
+	for name, seconds := range stats.projects {
+		projectRows = append(projectRows, projectRow{name: name, seconds: seconds})
+	}
+	sort.Slice(projectRows, func(i, j int) bool {
+		if projectRows[i].seconds != projectRows[j].seconds {
+			return projectRows[i].seconds > projectRows[j].seconds
+		}
+		return projectRows[i].name < projectRows[j].name
+	})
+
+	var b strings.Builder
+	b.WriteString("# Project Summary (")
+	b.WriteString(stats.days[0].date)
+	b.WriteString(" - ")
+	b.WriteString(stats.days[len(stats.days)-1].date)
+	b.WriteString(")\n\n")
+	b.WriteString("| Project")
+	b.WriteString(strings.Repeat(" ", markdownNameWidth-7))
+	for _, day := range stats.days {
+		b.WriteString(" | ")
+		parsed, _ := time.Parse(dateLayout, day.date)
+		b.WriteString(padLeftWidth(parsed.Format(markdownDayLayout), markdownDayWidth))
+	}
+	b.WriteString(" | Time(min) |\n")
+	b.WriteString("| ")
+	b.WriteString(strings.Repeat("-", markdownNameWidth))
+	for range stats.days {
+		b.WriteString(" | ")
+		b.WriteString(strings.Repeat("-", markdownDayWidth))
+	}
+	b.WriteString(" | ")
+	b.WriteString(strings.Repeat("-", markdownTimeWidth))
+	b.WriteString(" |\n")
+	for _, row := range projectRows {
+		b.WriteString("| ")
+		b.WriteString(padRightWidth(row.name, markdownNameWidth))
+		for _, day := range stats.days {
+			b.WriteString(" | ")
+			b.WriteString(padLeftWidth(strconv.FormatInt(ceilMinutes(day.projects[row.name]), 10), markdownDayWidth))
+		}
+		b.WriteString(" | ")
+		b.WriteString(padLeftWidth(strconv.FormatInt(ceilMinutes(row.seconds), 10), markdownTimeWidth))
+		b.WriteString(" |\n")
+	}
+
+	writeTrackedMarkdown(&b, stats.tracked)
+	if stats.projectOthers != nil {
+		writeOthersMarkdown(&b, stats.projectOthers)
+	}
+	return b.String()
+}
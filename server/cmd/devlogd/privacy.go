@@ -0,0 +1,418 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"devlog-report/internal/events"
+)
+
+const redactedMarker = "[REDACTED]"
+
+const (
+	urlActionKeep       = "keep"
+	urlActionStripQuery = "strip_query"
+	urlActionHostOnly   = "host_only"
+	urlActionDrop       = "drop"
+)
+
+var errIgnoredEvent = errors.New("event ignored by privacy rules")
+
+type PrivacyConfig struct {
+	Deny   DenyConfig   `yaml:"deny"`
+	Redact RedactConfig `yaml:"redact"`
+	URLs   []URLPolicy  `yaml:"urls"`
+}
+
+type DenyConfig struct {
+	CWD     []string `yaml:"cwd"`
+	URL     []string `yaml:"url"`
+	Title   []string `yaml:"title"`
+	Command []string `yaml:"command"`
+}
+
+type URLPolicy struct {
+	Domains []string `yaml:"domains"`
+	Action  string   `yaml:"action"`
+	Title   string   `yaml:"title"`
+}
+
+type RedactConfig struct {
+	Builtin *bool        `yaml:"builtin"`
+	Rules   []RedactRule `yaml:"rules"`
+}
+
+type RedactRule struct {
+	Pattern string  `yaml:"pattern"`
+	Replace *string `yaml:"replace"`
+}
+
+func (c RedactConfig) builtin() bool {
+	return c.Builtin == nil || *c.Builtin
+}
+
+type redactRule struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+var builtinRedactRules = []redactRule{
+	{regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@'"]+:)[^/\s@'"]+@`), "${1}" + redactedMarker + "@"},
+	{regexp.MustCompile(`(?i)((?:authorization|proxy-authorization)\s*:\s*(?:bearer|basic|token|bot)\s+)[^\s'"]+`), "${1}" + redactedMarker},
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]{8,}`), "${1}" + redactedMarker},
+	{regexp.MustCompile(`(?i)(\b[A-Z0-9_]*(?:TOKEN|SECRET|PASSWORD|PASSWD|PASSPHRASE|API_?KEY|ACCESS_KEY|PRIVATE_KEY|CREDENTIALS?)[A-Z0-9_]*\s*=\s*)(?:'[^']*'|"[^"]*"|[^\s;&|]+)`), "${1}" + redactedMarker},
+	{regexp.MustCompile(`(?i)(\s--?(?:password|passwd|pass|token|secret|api-key|apikey|access-token|client-secret)(?:=|\s+))(?:'[^']*'|"[^"]*"|[^\s;&|]+)`), "${1}" + redactedMarker},
+	{regexp.MustCompile(`(\b(?:mysql|mysqldump|mysqladmin|mariadb|mariadb-dump)\b[^|;&\n]*?\s-p)(?:'[^']*'|"[^"]*"|[^\s;&|'"]+)`), "${1}" + redactedMarker},
+	{regexp.MustCompile(`(\bsshpass\s+-p\s*)(?:'[^']*'|"[^"]*"|[^\s;&|]+)`), "${1}" + redactedMarker},
+	{regexp.MustCompile(`(\s(?:-u|--user)\s+[^\s:'"]+:)(?:'[^']*'|"[^"]*"|[^\s;&|'"]+)`), "${1}" + redactedMarker},
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), redactedMarker},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b|\bgithub_pat_[A-Za-z0-9_]{22,}`), redactedMarker},
+	{regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`), redactedMarker},
+	{regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`), redactedMarker},
+	{regexp.MustCompile(`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}`), redactedMarker},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), redactedMarker},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), redactedMarker},
+}
+
+type urlRule struct {
+	domains []string
+	action  string
+	title   string
+}
+
+func (r urlRule) matches(host string) bool {
+	for _, domain := range r.domains {
+		if domain == "*" || host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+type privacyPolicy struct {
+	denyCWD     []*regexp.Regexp
+	denyURL     []*regexp.Regexp
+	denyTitle   []*regexp.Regexp
+	denyCommand []*regexp.Regexp
+	redact      []redactRule
+	urls        []urlRule
+}
+
+var defaultPrivacyPolicy = &privacyPolicy{redact: builtinRedactRules}
+
+func compilePrivacyPolicy(cfg PrivacyConfig) (*privacyPolicy, error) {
+	policy := &privacyPolicy{}
+	for _, deny := range []struct {
+		patterns []string
+		target   *[]*regexp.Regexp
+	}{
+		{cfg.Deny.CWD, &policy.denyCWD},
+		{cfg.Deny.URL, &policy.denyURL},
+		{cfg.Deny.Title, &policy.denyTitle},
+		{cfg.Deny.Command, &policy.denyCommand},
+	} {
+		for _, pattern := range deny.patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			*deny.target = append(*deny.target, re)
+		}
+	}
+	if cfg.Redact.builtin() {
+		policy.redact = append(policy.redact, builtinRedactRules...)
+	}
+	for _, rule := range cfg.Redact.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		replace := redactedMarker
+		if rule.Replace != nil {
+			replace = *rule.Replace
+		}
+		policy.redact = append(policy.redact, redactRule{re: re, replace: replace})
+	}
+	for _, rule := range cfg.URLs {
+		entry := urlRule{action: rule.Action, title: rule.Title}
+		if entry.action == "" {
+			entry.action = urlActionKeep
+		}
+		for _, domain := range rule.Domains {
+			entry.domains = append(entry.domains, strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), ".")))
+		}
+		policy.urls = append(policy.urls, entry)
+	}
+	return policy, nil
+}
+
+func loadPrivacyPolicy(path string) (*privacyPolicy, error) {
+	cfg, err := loadProjectsConfig(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultPrivacyPolicy, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return compilePrivacyPolicy(cfg.Privacy)
+}
+
+func (p *privacyPolicy) redactText(value string) string {
+	for _, rule := range p.redact {
+		value = rule.re.ReplaceAllString(value, rule.replace)
+	}
+	return value
+}
+
+func (p *privacyPolicy) redactEvent(ev *events.Event) bool {
+	changed := false
+	for _, field := range []*string{&ev.Command, &ev.CWD, &ev.URL, &ev.Title} {
+		if *field == "" {
+			continue
+		}
+		if redacted := p.redactText(*field); redacted != *field {
+			*field = redacted
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (p *privacyPolicy) redactPayload(payload []byte) ([]byte, bool, error) {
+	var raw events.Event
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, false, err
+	}
+	if !p.redactEvent(&raw) {
+		return payload, false, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (p *privacyPolicy) urlRule(rawURL string) (urlRule, bool) {
+	host := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	for _, rule := range p.urls {
+		if rule.matches(host) {
+			return rule, true
+		}
+	}
+	return urlRule{}, false
+}
+
+func sanitizeURL(rawURL, action string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	switch action {
+	case urlActionStripQuery:
+		u.RawQuery = ""
+		u.ForceQuery = false
+		u.Fragment = ""
+		u.RawFragment = ""
+	case urlActionHostOnly:
+		if u.Host == "" {
+			return rawURL
+		}
+		u = &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	}
+	return u.String()
+}
+
+func matchesAny(patterns []*regexp.Regexp, value string) bool {
+	for _, re := range patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *privacyPolicy) denied(ev events.Event) bool {
+	switch ev.Type {
+	case "browser_active_span":
+		return matchesAny(p.denyURL, ev.URL) || matchesAny(p.denyTitle, ev.Title)
+	case "terminal_command":
+		return matchesAny(p.denyCWD, ev.CWD) || matchesAny(p.denyCommand, ev.Command)
+	}
+	return false
+}
+
+func (p *privacyPolicy) apply(ev *events.Event) (bool, error) {
+	if p.denied(*ev) {
+		return false, errIgnoredEvent
+	}
+	changed := false
+	if ev.Type == "browser_active_span" {
+		if rule, ok := p.urlRule(ev.URL); ok {
+			if rule.action == urlActionDrop {
+				return false, errIgnoredEvent
+			}
+			if sanitized := sanitizeURL(ev.URL, rule.action); sanitized != ev.URL {
+				ev.URL = sanitized
+				changed = true
+			}
+			if rule.title != "" && rule.title != ev.Title {
+				ev.Title = rule.title
+				changed = true
+			}
+		}
+	}
+	if p.redactEvent(ev) {
+		changed = true
+	}
+	return changed, nil
+}
+
+func (p *privacyPolicy) prepare(payload []byte) (events.Event, []byte, error) {
+	ev, err := events.Normalize(payload)
+	if err != nil {
+		return events.Event{}, nil, err
+	}
+	changed, err := p.apply(&ev)
+	if err != nil || !changed {
+		return ev, payload, err
+	}
+	var raw events.Event
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return events.Event{}, nil, err
+	}
+	if _, err := p.apply(&raw); err != nil {
+		return events.Event{}, nil, err
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return events.Event{}, nil, err
+	}
+	return ev, data, nil
+}
+
+type storedRedaction struct {
+	id      int64
+	fields  [4]string
+	payload []byte
+}
+
+func (s *eventStore) redactStored(privacy *privacyPolicy, rewrite bool) (int, int, error) {
+	rows, err := s.db.Query(`SELECT id, url, title, cwd, command, payload FROM events ORDER BY id`)
+	if err != nil {
+		return 0, 0, err
+	}
+	var pending []storedRedaction
+	for rows.Next() {
+		var row storedRedaction
+		var values [4]sql.NullString
+		var payload string
+		if err := rows.Scan(&row.id, &values[0], &values[1], &values[2], &values[3], &payload); err != nil {
+			_ = rows.Close()
+			return 0, 0, err
+		}
+		changed := false
+		for i, value := range values {
+			row.fields[i] = privacy.redactText(value.String)
+			changed = changed || row.fields[i] != value.String
+		}
+		redacted, payloadChanged, err := privacy.redactPayload([]byte(payload))
+		if err != nil {
+			redacted = []byte(privacy.redactText(payload))
+			payloadChanged = string(redacted) != payload
+		}
+		row.payload = redacted
+		if changed || payloadChanged {
+			pending = append(pending, row)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return 0, 0, err
+	}
+	if err := rows.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	rollups, err := s.db.Query(`SELECT rowid, day, window_start_ms, window_end_ms, type, title, url, cwd, command, intervals FROM daily_rollups`)
+	if err != nil {
+		return 0, 0, err
+	}
+	type rollupRedaction struct {
+		rowid  int64
+		key    rollupKey
+		values []interval
+	}
+	var pendingRollups []rollupRedaction
+	for rollups.Next() {
+		var row rollupRedaction
+		var data string
+		if err := rollups.Scan(&row.rowid, &row.key.day, &row.key.windowStart, &row.key.windowEnd, &row.key.eventType,
+			&row.key.title, &row.key.url, &row.key.cwd, &row.key.command, &data); err != nil {
+			_ = rollups.Close()
+			return 0, 0, err
+		}
+		original := row.key
+		for _, field := range []*string{&row.key.title, &row.key.url, &row.key.cwd, &row.key.command} {
+			*field = privacy.redactText(*field)
+		}
+		if row.key == original {
+			continue
+		}
+		if row.values, err = decodeRollupIntervals(data); err != nil {
+			_ = rollups.Close()
+			return 0, 0, err
+		}
+		pendingRollups = append(pendingRollups, row)
+	}
+	if err := rollups.Err(); err != nil {
+		_ = rollups.Close()
+		return 0, 0, err
+	}
+	if err := rollups.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	if !rewrite || len(pending)+len(pendingRollups) == 0 {
+		return len(pending), len(pendingRollups), nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	update, err := tx.Prepare(`UPDATE events SET url = ?, title = ?, cwd = ?, command = ?, payload = ? WHERE id = ?`)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer update.Close()
+	for _, row := range pending {
+		if _, err := update.Exec(row.fields[0], row.fields[1], row.fields[2], row.fields[3], string(row.payload), row.id); err != nil {
+			return 0, 0, err
+		}
+	}
+	for _, row := range pendingRollups {
+		if _, err := tx.Exec(`DELETE FROM daily_rollups WHERE rowid = ?`, row.rowid); err != nil {
+			return 0, 0, err
+		}
+		if err := mergeRollup(tx, row.key, row.values); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return 0, 0, err
+	}
+	return len(pending), len(pendingRollups), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"devlog-report/internal/events"
+)
+
+const purgePreviewLimit = 20
+
+type purgeFilter struct {
+	from      time.Time
+	to        time.Time
+	eventType string
+	match     *regexp.Regexp
+}
+
+type purgeResult struct {
+	DryRun  bool           `json:"dry_run"`
+	PurgeID int64          `json:"purge_id,omitempty"`
+	Events  int            `json:"events"`
+	Rollups int            `json:"rollups"`
+	Preview []events.Event `json:"preview"`
+}
+
+func parsePurgeFilter(query url.Values, defaults dayOptions) (purgeFilter, error) {
+	var filter purgeFilter
+	opts, err := parseDayOptions(query, defaults)
+	if err != nil {
+		return purgeFilter{}, err
+	}
+	from, to := query.Get("from"), query.Get("to")
+	if from == "" || to == "" {
+		return purgeFilter{}, errors.New("from and to are required")
+	}
+	if filter.from, err = parsePurgeBound(from, opts, false); err != nil {
+		return purgeFilter{}, errors.New("from must be YYYY-MM-DD or RFC3339")
+	}
+	if filter.to, err = parsePurgeBound(to, opts, true); err != nil {
+		return purgeFilter{}, errors.New("to must be YYYY-MM-DD or RFC3339")
+	}
+	if !filter.to.After(filter.from) {
+		return purgeFilter{}, errors.New("to must be after from")
+	}
+	switch eventType := query.Get("type"); eventType {
+	case "", "browser_active_span", "terminal_command":
+		filter.eventType = eventType
+	default:
+		return purgeFilter{}, errors.New("type must be 'browser_active_span' or 'terminal_command'")
+	}
+	if match := query.Get("match"); match != "" {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return purgeFilter{}, errors.New("match must be a valid regular expression: " + err.Error())
+		}
+		filter.match = re
+	}
+	return filter, nil
+}
+
+func parsePurgeBound(value string, opts dayOptions, end bool) (time.Time, error) {
+	if _, err := time.Parse(dateLayout, value); err == nil {
+		if end {
+			return opts.window(value).end, nil
+		}
+		return opts.window(value).start, nil
+	}
+	return events.ParseTime(value)
+}
+
+func parseDryRun(query url.Values) (bool, error) {
+	value := query.Get("dry_run")
+	if value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("dry_run must be true or false")
+	}
+	return dryRun, nil
+}
+
+func (f purgeFilter) matches(values ...string) bool {
+	if f.match == nil {
+		return true
+	}
+	for _, value := range values {
+		if value != "" && f.match.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f purgeFilter) matchString() string {
+	if f.match == nil {
+		return ""
+	}
+	return f.match.String()
+}
+
+func (s *eventStore) purge(filter purgeFilter, dryRun bool) (purgeResult, error) {
+	result := purgeResult{DryRun: dryRun, Preview: []events.Event{}}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	query := `
+SELECT id, event_id, type, source, schema_version, start_ts, end_ts, url, title, cwd, command
+FROM events
+WHERE start_ms >= ? AND start_ms < ?`
+	args := []any{filter.from.UnixMilli(), filter.to.UnixMilli()}
+	if filter.eventType != "" {
+		query += ` AND type = ?`
+		args = append(args, filter.eventType)
+	}
+	rows, err := tx.Query(query+` ORDER BY start_ms, id`, args...)
+	if err != nil {
+		return result, err
+	}
+	var ids []int64
+	eventIDs := []string{}
+	for rows.Next() {
+		var id int64
+		var ev events.Event
+		var url, title, cwd, command sql.NullString
+		if err := rows.Scan(&id, &ev.EventID, &ev.Type, &ev.Source, &ev.SchemaVersion, &ev.StartTS, &ev.EndTS, &url, &title, &cwd, &command); err != nil {
+			_ = rows.Close()
+			return result, err
+		}
+		ev.URL, ev.Title, ev.CWD, ev.Command = url.String, title.String, cwd.String, command.String
+		if !filter.matches(ev.URL, ev.Title, ev.CWD, ev.Command) {
+			continue
+		}
+		ids = append(ids, id)
+		eventIDs = append(eventIDs, ev.EventID)
+		if len(result.Preview) < purgePreviewLimit {
+			result.Preview = append(result.Preview, ev)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return result, err
+	}
+	if err := rows.Close(); err != nil {
+		return result, err
+	}
+	result.Events = len(ids)
+
+	rollups, err := purgeRollups(tx, filter, dryRun)
+	if err != nil {
+		return result, err
+	}
+	result.Rollups = rollups
+	if dryRun || result.Events+result.Rollups == 0 {
+		return result, nil
+	}
+
+	remove, err := tx.Prepare(`DELETE FROM events WHERE id = ?`)
+	if err != nil {
+		return result, err
+	}
+	defer remove.Close()
+	for _, id := range ids {
+		if _, err := remove.Exec(id); err != nil {
+			return result, err
+		}
+	}
+
+	data, err := json.Marshal(eventIDs)
+	if err != nil {
+		return result, err
+	}
+	res, err := tx.Exec(`
+INSERT INTO purges (purged_at, from_ms, to_ms, type, match, events, rollups, event_ids)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`,
+		time.Now().UTC().Format(time.RFC3339Nano), filter.from.UnixMilli(), filter.to.UnixMilli(), filter.eventType,
+		filter.matchString(), result.Events, result.Rollups, string(data),
+	)
+	if err != nil {
+		return result, err
+	}
+	if result.PurgeID, err = res.LastInsertId(); err != nil {
+		return result, err
+	}
+	return result, tx.Commit()
+}
+
+func purgeRollups(tx *sql.Tx, filter purgeFilter, dryRun bool) (int, error) {
+	query := `
+SELECT rowid, title, url, cwd, command, intervals
+FROM daily_rollups
+WHERE window_start_ms < ? AND window_end_ms > ?`
+	args := []any{filter.to.UnixMilli(), filter.from.UnixMilli()}
+	if filter.eventType != "" {
+		query += ` AND type = ?`
+		args = append(args, filter.eventType)
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	type trimmedRollup struct {
+		rowid  int64
+		values []interval
+	}
+	var trimmed []trimmedRollup
+	for rows.Next() {
+		var rowid int64
+		var title, url, cwd, command, data string
+		if err := rows.Scan(&rowid, &title, &url, &cwd, &command, &data); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		if !filter.matches(url, title, cwd, command) {
+			continue
+		}
+		values, err := decodeRollupIntervals(data)
+		if err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		kept := values[:0]
+		for _, value := range values {
+			if !value.start.Before(filter.from) && value.start.Before(filter.to) {
+				continue
+			}
+			kept = append(kept, value)
+		}
+		if len(kept) < len(values) {
+			trimmed = append(trimmed, trimmedRollup{rowid: rowid, values: kept})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return 0, err
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if dryRun {
+		return len(trimmed), nil
+	}
+
+	for _, row := range trimmed {
+		if len(row.values) == 0 {
+			if _, err := tx.Exec(`DELETE FROM daily_rollups WHERE rowid = ?`, row.rowid); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		minStart, maxEnd, data, err := encodeRollupIntervals(row.values)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+UPDATE daily_rollups SET min_start_ms = ?, max_end_ms = ?, seconds = ?, intervals = ?
+WHERE rowid = ?
+`, minStart.UnixMilli(), maxEnd.UnixMilli(), sumIntervalSeconds(row.values), data, row.rowid)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(trimmed), nil
+}
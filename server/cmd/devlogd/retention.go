@@ -0,0 +1,272 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const compactChunkSize = 5000
+
+type retentionPolicy struct {
+	days     int
+	interval time.Duration
+	dayOpts  dayOptions
+}
+
+type rollupKey struct {
+	day         string
+	windowStart int64
+	windowEnd   int64
+	eventType   string
+	title       string
+	url         string
+	cwd         string
+	command     string
+}
+
+func (p retentionPolicy) cutoff(now time.Time) time.Time {
+	today := p.dayOpts.windowAt(now)
+	day, _ := time.Parse(dateLayout, today.date)
+	return p.dayOpts.window(day.AddDate(0, 0, -p.days).Format(dateLayout)).start
+}
+
+func (p retentionPolicy) run(store *eventStore) {
+	cutoff := p.cutoff(time.Now())
+	compacted, err := store.compactBefore(p.dayOpts, cutoff)
+	if err != nil {
+		log.Printf("retention: compaction failed after %d events: %v", compacted, err)
+		return
+	}
+	if compacted == 0 {
+		return
+	}
+	if _, err := store.db.Exec(`VACUUM`); err != nil {
+		log.Printf("retention: vacuum failed: %v", err)
+	}
+	log.Printf("retention: compacted %d events before %s into daily_rollups", compacted, cutoff.Format(time.RFC3339))
+}
+
+func (p retentionPolicy) watch(store *eventStore) {
+	p.run(store)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.run(store)
+	}
+}
+
+func (s *eventStore) compactBefore(opts dayOptions, cutoff time.Time) (int, error) {
+	total := 0
+	for _, eventType := range []string{"browser_active_span", "terminal_command"} {
+		for {
+			n, err := s.compactChunk(opts, eventType, cutoff)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			if n < compactChunkSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+func (s *eventStore) compactChunk(opts dayOptions, eventType string, cutoff time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+SELECT id, event_id, title, url, cwd, command, start_ms, end_ms
+FROM events
+WHERE type = ? AND start_ms < ? AND end_ms <= ?
+ORDER BY start_ms
+LIMIT ?
+`, eventType, cutoff.UnixMilli(), cutoff.UnixMilli(), compactChunkSize)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	var eventIDs []string
+	pieces := make(map[rollupKey][]interval)
+	for rows.Next() {
+		var id int64
+		var eventID string
+		var title, url, cwd, command sql.NullString
+		var startMS, endMS int64
+		if err := rows.Scan(&id, &eventID, &title, &url, &cwd, &command, &startMS, &endMS); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		eventIDs = append(eventIDs, eventID)
+
+		key := rollupKey{eventType: eventType}
+		if eventType == "browser_active_span" {
+			key.title = strings.TrimSpace(title.String)
+			if key.title == "" {
+				key.title = url.String
+			}
+			key.url = url.String
+		} else {
+			key.cwd = cwd.String
+			key.command = command.String
+		}
+		start := time.UnixMilli(startMS)
+		end := time.UnixMilli(endMS)
+		for w := opts.windowAt(start); w.start.Before(end) || w.start.Equal(start); w = w.next(opts) {
+			key.day = w.date
+			key.windowStart = w.start.UnixMilli()
+			key.windowEnd = w.end.UnixMilli()
+			pieceStart, pieceEnd := w.clip(start, end)
+			pieces[key] = append(pieces[key], interval{start: pieceStart, end: pieceEnd})
+			if !end.After(start) {
+				break
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return 0, err
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	for key, values := range pieces {
+		if err := mergeRollup(tx, key, values); err != nil {
+			return 0, err
+		}
+	}
+	remember, err := tx.Prepare(`INSERT OR IGNORE INTO compacted_events (event_id) VALUES (?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer remember.Close()
+	remove, err := tx.Prepare(`DELETE FROM events WHERE id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer remove.Close()
+	for i, id := range ids {
+		if _, err := remember.Exec(eventIDs[i]); err != nil {
+			return 0, err
+		}
+		if _, err := remove.Exec(id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+func mergeRollup(tx *sql.Tx, key rollupKey, values []interval) error {
+	var existing string
+	err := tx.QueryRow(`
+SELECT intervals FROM daily_rollups
+WHERE type = ? AND window_start_ms = ? AND title = ? AND url = ? AND cwd = ? AND command = ?
+`, key.eventType, key.windowStart, key.title, key.url, key.cwd, key.command).Scan(&existing)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if existing != "" {
+		previous, err := decodeRollupIntervals(existing)
+		if err != nil {
+			return err
+		}
+		values = append(previous, values...)
+	}
+
+	minStart, maxEnd, data, err := encodeRollupIntervals(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO daily_rollups (
+	day, window_start_ms, window_end_ms, type, title, url, cwd, command,
+	min_start_ms, max_end_ms, seconds, intervals
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (type, window_start_ms, title, url, cwd, command) DO UPDATE SET
+	min_start_ms = excluded.min_start_ms,
+	max_end_ms = excluded.max_end_ms,
+	seconds = excluded.seconds,
+	intervals = excluded.intervals
+`,
+		key.day, key.windowStart, key.windowEnd, key.eventType, key.title, key.url, key.cwd, key.command,
+		minStart.UnixMilli(), maxEnd.UnixMilli(), sumIntervalSeconds(values), data,
+	)
+	return err
+}
+
+func encodeRollupIntervals(values []interval) (time.Time, time.Time, string, error) {
+	minStart, maxEnd := values[0].start, values[0].end
+	encoded := make([][2]int64, 0, len(values))
+	for _, value := range values {
+		if value.start.Before(minStart) {
+			minStart = value.start
+		}
+		if value.end.After(maxEnd) {
+			maxEnd = value.end
+		}
+		encoded = append(encoded, [2]int64{value.start.UnixMilli(), value.end.UnixMilli()})
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	return minStart, maxEnd, string(data), nil
+}
+
+func decodeRollupIntervals(data string) ([]interval, error) {
+	var encoded [][2]int64
+	if err := json.Unmarshal([]byte(data), &encoded); err != nil {
+		return nil, err
+	}
+	out := make([]interval, 0, len(encoded))
+	for _, value := range encoded {
+		out = append(out, interval{start: time.UnixMilli(value[0]).UTC(), end: time.UnixMilli(value[1]).UTC()})
+	}
+	return out, nil
+}
+
+func (s *eventStore) rollupIntervals(window dayWindow, eventType string, visit func(key rollupKey, value interval)) error {
+	rows, err := s.db.Query(`
+SELECT title, url, cwd, command, intervals
+FROM daily_rollups
+WHERE type = ? AND window_start_ms < ? AND window_end_ms > ?
+`, eventType, window.end.UnixMilli(), window.start.UnixMilli())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key := rollupKey{eventType: eventType}
+		var data string
+		if err := rows.Scan(&key.title, &key.url, &key.cwd, &key.command, &data); err != nil {
+			return err
+		}
+		values, err := decodeRollupIntervals(data)
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			if !value.start.Before(window.end) || (!value.end.After(window.start) && value.start.Before(window.start)) {
+				continue
+			}
+			start, end := window.clip(value.start, value.end)
+			visit(key, interval{start: start, end: end})
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	terminalModelSpan    = "span"
+	terminalModelSession = "session"
+)
+
+type interval struct {
+	start time.Time
+	end   time.Time
+}
+
+type terminalModel struct {
+	kind  string
+	gap   time.Duration
+	tail  time.Duration
+	until time.Time
+}
+
+func loadTerminalModel(kind, gap, tail string) (terminalModel, error) {
+	return parseTerminalModel(url.Values{
+		"terminal_model": {kind},
+		"session_gap":    {gap},
+		"session_tail":   {tail},
+	}, terminalModel{})
+}
+
+func parseTerminalModel(query url.Values, defaults terminalModel) (terminalModel, error) {
+	model := defaults
+	if kind := query.Get("terminal_model"); kind != "" {
+		if kind != terminalModelSpan && kind != terminalModelSession {
+			return terminalModel{}, errors.New("terminal_model must be 'span' or 'session'")
+		}
+		model.kind = kind
+	}
+	if value := query.Get("session_gap"); value != "" {
+		gap, err := time.ParseDuration(value)
+		if err != nil || gap < 0 {
+			return terminalModel{}, errors.New("session_gap must be a duration (e.g. 15m)")
+		}
+		model.gap = gap
+	}
+	if value := query.Get("session_tail"); value != "" {
+		tail, err := time.ParseDuration(value)
+		if err != nil || tail < 0 {
+			return terminalModel{}, errors.New("session_tail must be a duration (e.g. 5m)")
+		}
+		model.tail = tail
+	}
+	if model.kind == "" {
+		model.kind = terminalModelSpan
+	}
+	return model, nil
+}
+
+func (m terminalModel) within(window dayWindow) terminalModel {
+	m.until = window.end
+	return m
+}
+
+func (m terminalModel) spanSeconds(entry span) int64 {
+	return intervalsSeconds(m.intervalsOf(entry))
+}
+
+func (m terminalModel) intervalsOf(entry span) []interval {
+	if m.kind == terminalModelSession {
+		return m.sessions(entry.intervals)
+	}
+	if entry.maxEnd.Before(entry.minStart) {
+		return nil
+	}
+	return []interval{{start: entry.minStart, end: entry.maxEnd}}
+}
+
+func (m terminalModel) sessions(values []interval) []interval {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]interval(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start.Before(sorted[j].start)
+	})
+
+	var out []interval
+	current := sorted[0]
+	closeSession := func() {
+		end := current.end.Add(m.tail)
+		if !m.until.IsZero() && end.After(m.until) {
+			end = m.until
+		}
+		if end.Before(current.end) {
+			end = current.end
+		}
+		out = append(out, interval{start: current.start, end: end})
+	}
+	for _, next := range sorted[1:] {
+		if next.start.Sub(current.end) <= m.gap {
+			if next.end.After(current.end) {
+				current.end = next.end
+			}
+			continue
+		}
+		closeSession()
+		current = next
+	}
+	closeSession()
+	return out
+}
+
+func sumIntervalSeconds(values []interval) int64 {
+	var total int64
+	for _, value := range values {
+		secs := int64(value.end.Sub(value.start).Seconds())
+		if secs > 0 {
+			total += secs
+		}
+	}
+	return total
+}
+
+func intervalsSeconds(values []interval) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]interval(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start.Before(sorted[j].start)
+	})
+
+	var total time.Duration
+	current := sorted[0]
+	for _, next := range sorted[1:] {
+		if !next.start.After(current.end) {
+			if next.end.After(current.end) {
+				current.end = next.end
+			}
+			continue
+		}
+		total += current.end.Sub(current.start)
+		current = next
+	}
+	total += current.end.Sub(current.start)
+	return int64(total.Seconds())
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type configProblem struct {
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p configProblem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		b.WriteString("line ")
+		b.WriteString(strconv.Itoa(p.Line))
+		b.WriteString(": ")
+	}
+	if p.Path != "" {
+		b.WriteString(p.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+type configError struct {
+	problems []configProblem
+}
+
+func (e *configError) Error() string {
+	lines := make([]string, 0, len(e.problems))
+	for _, problem := range e.problems {
+		lines = append(lines, problem.String())
+	}
+	return "invalid projects config: " + strings.Join(lines, "; ")
+}
+
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+func yamlProblem(message string) configProblem {
+	m := yamlLinePattern.FindStringSubmatch(message)
+	if m == nil {
+		return configProblem{Message: strings.TrimPrefix(message, "yaml: ")}
+	}
+	line, _ := strconv.Atoi(m[1])
+	return configProblem{Line: line, Message: m[2]}
+}
+
+func validateProjectsConfig(data []byte) (ProjectsConfig, []configProblem) {
+	var cfg ProjectsConfig
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return cfg, []configProblem{yamlProblem(err.Error())}
+	}
+
+	var problems []configProblem
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, message := range typeErr.Errors {
+				problems = append(problems, yamlProblem(message))
+			}
+		} else {
+			problems = append(problems, yamlProblem(err.Error()))
+		}
+	}
+
+	doc := &root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	problems = append(problems, validatePrivacy(doc)...)
+
+	projectsNode := yamlMappingValue(doc, "projects")
+	if projectsNode == nil || projectsNode.Kind != yaml.SequenceNode {
+		sort.SliceStable(problems, func(i, j int) bool {
+			return problems[i].Line < problems[j].Line
+		})
+		return cfg, problems
+	}
+
+	patternFields := []struct {
+		section string
+		field   string
+	}{
+		{"browser", "title"},
+		{"browser", "url"},
+		{"terminal", "cwd"},
+		{"terminal", "command"},
+	}
+
+	firstLine := make(map[string]int)
+	for i, item := range projectsNode.Content {
+		path := fmt.Sprintf("projects[%d]", i)
+		nameNode := yamlMappingValue(item, "name")
+		switch {
+		case nameNode == nil || strings.TrimSpace(nameNode.Value) == "":
+			problems = append(problems, configProblem{Line: item.Line, Path: path + ".name", Message: "name is required"})
+		case firstLine[nameNode.Value] > 0:
+			problems = append(problems, configProblem{
+				Line:    nameNode.Line,
+				Path:    path + ".name",
+				Message: fmt.Sprintf("duplicate project name %q (first defined on line %d)", nameNode.Value, firstLine[nameNode.Value]),
+			})
+		default:
+			firstLine[nameNode.Value] = nameNode.Line
+		}
+
+		matchNode := yamlMappingValue(item, "match")
+		for _, pf := range patternFields {
+			seq := yamlMappingValue(yamlMappingValue(matchNode, pf.section), pf.field)
+			if seq == nil || seq.Kind != yaml.SequenceNode {
+				continue
+			}
+			for j, patternNode := range seq.Content {
+				if _, err := regexp.Compile(patternNode.Value); err != nil {
+					problems = append(problems, configProblem{
+						Line:    patternNode.Line,
+						Path:    fmt.Sprintf("%s.match.%s.%s[%d]", path, pf.section, pf.field, j),
+						Message: err.Error(),
+					})
+				}
+			}
+		}
+	}
+
+	if _, ok := firstLine[cfg.Output.otherName()]; ok && cfg.Output.includeOther() {
+		line := 0
+		if node := yamlMappingValue(yamlMappingValue(doc, "output"), "other_name"); node != nil {
+			line = node.Line
+		}
+		problems = append(problems, configProblem{
+			Line:    line,
+			Path:    "output.other_name",
+			Message: fmt.Sprintf("%q is also used as a project name", cfg.Output.otherName()),
+		})
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return cfg, problems
+}
+
+func validatePrivacy(doc *yaml.Node) []configProblem {
+	var problems []configProblem
+	privacyNode := yamlMappingValue(doc, "privacy")
+
+	denyNode := yamlMappingValue(privacyNode, "deny")
+	for _, field := range []string{"cwd", "url", "title", "command"} {
+		seq := yamlMappingValue(denyNode, field)
+		if seq == nil || seq.Kind != yaml.SequenceNode {
+			continue
+		}
+		for i, patternNode := range seq.Content {
+			if _, err := regexp.Compile(patternNode.Value); err != nil {
+				problems = append(problems, configProblem{
+					Line:    patternNode.Line,
+					Path:    fmt.Sprintf("privacy.deny.%s[%d]", field, i),
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+
+	if urls := yamlMappingValue(privacyNode, "urls"); urls != nil && urls.Kind == yaml.SequenceNode {
+		for i, policy := range urls.Content {
+			path := fmt.Sprintf("privacy.urls[%d]", i)
+			domains := yamlMappingValue(policy, "domains")
+			if domains == nil || domains.Kind != yaml.SequenceNode || len(domains.Content) == 0 {
+				problems = append(problems, configProblem{Line: policy.Line, Path: path + ".domains", Message: "at least one domain is required"})
+			} else {
+				for j, domain := range domains.Content {
+					if strings.TrimSpace(domain.Value) == "" {
+						problems = append(problems, configProblem{Line: domain.Line, Path: fmt.Sprintf("%s.domains[%d]", path, j), Message: "domain must not be empty"})
+					}
+				}
+			}
+			switch action := yamlMappingValue(policy, "action"); {
+			case action == nil:
+			case action.Value == urlActionKeep, action.Value == urlActionStripQuery, action.Value == urlActionHostOnly, action.Value == urlActionDrop:
+			default:
+				problems = append(problems, configProblem{
+					Line:    action.Line,
+					Path:    path + ".action",
+					Message: fmt.Sprintf("unknown action %q (want keep, strip_query, host_only or drop)", action.Value),
+				})
+			}
+		}
+	}
+
+	rules := yamlMappingValue(yamlMappingValue(privacyNode, "redact"), "rules")
+	if rules == nil || rules.Kind != yaml.SequenceNode {
+		return problems
+	}
+	for i, rule := range rules.Content {
+		path := fmt.Sprintf("privacy.redact.rules[%d].pattern", i)
+		patternNode := yamlMappingValue(rule, "pattern")
+		if patternNode == nil || patternNode.Value == "" {
+			problems = append(problems, configProblem{Line: rule.Line, Path: path, Message: "pattern is required"})
+			continue
+		}
+		if _, err := regexp.Compile(patternNode.Value); err != nil {
+			problems = append(problems, configProblem{Line: patternNode.Line, Path: path, Message: err.Error()})
+		}
+	}
+	return problems
+}
+
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
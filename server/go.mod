@@ -8,9 +8,10 @@ require gopkg.in/yaml.v3 v3.0.1
 
 require github.com/mattn/go-runewidth v0.0.15
 
+require github.com/google/uuid v1.6.0
+
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/ncruces/go-strftime v0.1.9 // indirect
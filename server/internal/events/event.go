@@ -0,0 +1,134 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type Event struct {
+	Type          string `json:"type"`
+	Source        string `json:"source"`
+	EventID       string `json:"event_id"`
+	SchemaVersion int    `json:"schema_version"`
+
+	StartTS string `json:"start_ts,omitempty"`
+	EndTS   string `json:"end_ts,omitempty"`
+
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title,omitempty"`
+
+	CWD        string `json:"cwd,omitempty"`
+	Command    string `json:"command,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	DurationMS *int64 `json:"duration_ms,omitempty"`
+}
+
+const LatestSchemaVersion = 3
+
+func Normalize(b []byte) (Event, error) {
+	var ev Event
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ev); err != nil {
+		return Event{}, err
+	}
+
+	if err := Validate(ev); err != nil {
+		return Event{}, err
+	}
+
+	if ev.Type == "terminal_command" {
+		if ev.SchemaVersion < 3 {
+			ev.EndTS = ev.StartTS
+			ev.ExitCode = nil
+			ev.DurationMS = nil
+		} else if ev.DurationMS != nil && ev.EndTS == ev.StartTS {
+			startTime, _ := ParseTime(ev.StartTS)
+			endTime := startTime.Add(time.Duration(*ev.DurationMS) * time.Millisecond)
+			ev.EndTS = endTime.Format(time.RFC3339Nano)
+		}
+	}
+
+	return ev, nil
+}
+
+func Validate(ev Event) error {
+	if ev.Type == "" {
+		return errors.New("type is required")
+	}
+	if ev.Source == "" {
+		return errors.New("source is required")
+	}
+	if ev.EventID == "" {
+		return errors.New("event_id is required")
+	}
+	if ev.SchemaVersion == 0 {
+		return errors.New("schema_version is required")
+	}
+	if ev.SchemaVersion < 0 || ev.SchemaVersion > LatestSchemaVersion {
+		return errors.New("unsupported schema_version")
+	}
+	if ev.StartTS == "" || ev.EndTS == "" {
+		return errors.New("start_ts and end_ts are required")
+	}
+	if err := parseTime(ev.StartTS); err != nil {
+		return errors.New("start_ts must be RFC3339")
+	}
+	if err := parseTime(ev.EndTS); err != nil {
+		return errors.New("end_ts must be RFC3339")
+	}
+
+	switch ev.Type {
+	case "browser_active_span":
+		if ev.URL == "" {
+			return errors.New("url is required for browser_active_span")
+		}
+		if ev.Title == "" {
+			return errors.New("title is required for browser_active_span")
+		}
+	case "terminal_command":
+		if ev.CWD == "" {
+			return errors.New("cwd is required for terminal_command")
+		}
+		if ev.Command == "" {
+			return errors.New("command is required for terminal_command")
+		}
+		if ev.SchemaVersion >= 3 {
+			startTime, _ := ParseTime(ev.StartTS)
+			endTime, _ := ParseTime(ev.EndTS)
+			if endTime.Before(startTime) {
+				return errors.New("end_ts must not be before start_ts")
+			}
+			if ev.DurationMS != nil && *ev.DurationMS < 0 {
+				return errors.New("duration_ms must not be negative")
+			}
+		}
+	default:
+		return errors.New("unknown type")
+	}
+
+	return nil
+}
+
+func parseTime(value string) error {
+	if value == "" {
+		return errors.New("empty time")
+	}
+	if _, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return nil
+	}
+	_, err := time.Parse(time.RFC3339, value)
+	return err
+}
+
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("empty time")
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}